@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/mapofzones/txs-processor/pkg/x/postgres"
+)
+
+// fills first seen hours of addresses which were active before they were kept,
+// it is run once after deploy, so returning addresses are not counted as new
+func main() {
+	postgresConnector := os.Getenv("postgres")
+
+	ctx := context.Background()
+
+	db, err := postgres.NewProcessor(ctx, postgresConnector)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := db.BackfillFirstSeenAddresses(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("backfilled first seen addresses: ", rows)
+}
@@ -3,10 +3,20 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	processor "github.com/mapofzones/txs-processor/pkg"
+	"github.com/mapofzones/txs-processor/pkg/prices"
 	"github.com/mapofzones/txs-processor/pkg/rabbitmq"
+	"github.com/mapofzones/txs-processor/pkg/registry"
+	processorTypes "github.com/mapofzones/txs-processor/pkg/types"
+	"github.com/mapofzones/txs-processor/pkg/x/multi"
 	"github.com/mapofzones/txs-processor/pkg/x/postgres"
 )
 
@@ -14,6 +24,28 @@ func main() {
 	rabbitmqConnector := os.Getenv("rabbitmq")
 	postgresConnector := os.Getenv("postgres")
 	queueName := os.Getenv("queue")
+	rollupInterval := os.Getenv("rollup_interval")
+	reconcileInterval := os.Getenv("reconcile_interval")
+	registryPath := os.Getenv("registry")
+	denomMetadataPath := os.Getenv("denom_metadata")
+	pricesPath := os.Getenv("prices")
+	pricesInterval := os.Getenv("prices_interval")
+	caughtUpThreshold := os.Getenv("caught_up_threshold")
+	metricsAddress := os.Getenv("metrics")
+	secondaryConnector := os.Getenv("secondary_postgres")
+	secondaryMode := os.Getenv("secondary_mode")
+	excludeClosedChannels, _ := strconv.ParseBool(os.Getenv("exclude_closed_channels"))
+	decodeAddresses, _ := strconv.ParseBool(os.Getenv("decode_addresses"))
+	addressPrefixes := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("address_prefixes"), ",") {
+		if kv := strings.SplitN(pair, "=", 2); len(kv) == 2 {
+			addressPrefixes[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	channelCacheSize := postgres.DefaultChannelCacheSize
+	if size, err := strconv.Atoi(os.Getenv("channel_cache_size")); err == nil {
+		channelCacheSize = size
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -22,12 +54,146 @@ func main() {
 		log.Fatal(err)
 	}
 
-	db, err := postgres.NewProcessor(ctx, postgresConnector)
+	opts := []postgres.Option{
+		postgres.WithClosedChannelsExcluded(excludeClosedChannels),
+		postgres.WithChannelCacheSize(channelCacheSize),
+		postgres.WithAddressDecoding(decodeAddresses),
+		postgres.WithAddressPrefixes(addressPrefixes),
+	}
+
+	// zones are marked as caught up once their blocks are processed with lag below threshold
+	if len(caughtUpThreshold) > 0 {
+		threshold, err := time.ParseDuration(caughtUpThreshold)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, postgres.WithCaughtUpThreshold(threshold))
+
+		// zones which stop sending blocks are unmarked without waiting for their next block
+		caughtUp, err := postgres.NewCaughtUpJob(ctx, postgresConnector, threshold)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go caughtUp.Run(ctx, time.Minute)
+	}
+
+	// lag of zones is published at /debug/vars
+	if len(metricsAddress) > 0 {
+		go func() {
+			log.Println("metrics server stopped:", http.ListenAndServe(metricsAddress, nil))
+		}()
+	}
+
+	// zone metadata is reloaded on SIGHUP
+	if len(registryPath) > 0 {
+		zones, err := registry.Load(registryPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, postgres.WithRegistry(zones))
+
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go func() {
+			for range reload {
+				if err := zones.Reload(); err != nil {
+					log.Println("could not reload registry:", err)
+				}
+			}
+		}()
+	}
+
+	if len(denomMetadataPath) > 0 {
+		denoms, err := registry.LoadDenoms(denomMetadataPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, postgres.WithDenomMetadata(denoms))
+	}
+
+	db, err := postgres.NewProcessor(ctx, postgresConnector, opts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	processor := processor.NewProcessor(ctx, blocks, db)
+	if err := db.WarmChannelCache(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	// rollup of daily, weekly and monthly stats, it can be disabled with zero interval
+	interval := 5 * time.Minute
+	if len(rollupInterval) > 0 {
+		interval, err = time.ParseDuration(rollupInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if interval > 0 {
+		rollup, err := postgres.NewRollupJob(ctx, postgresConnector, postgres.Day, postgres.Week, postgres.Month)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go rollup.Run(ctx, interval)
+	}
+
+	// parked ibc transfers are counted once their channels are resolved, it can be disabled with zero interval
+	reconcile := 5 * time.Minute
+	if len(reconcileInterval) > 0 {
+		reconcile, err = time.ParseDuration(reconcileInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if reconcile > 0 {
+		job, err := postgres.NewReconcileJob(ctx, postgresConnector, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go job.Run(ctx, reconcile)
+	}
+
+	// prices are imported on start and then every interval, hours with changed prices are repriced,
+	// without file only prices which other jobs put to the table are watched
+	if len(pricesPath) > 0 || len(pricesInterval) > 0 {
+		var source prices.Source
+		if len(pricesPath) > 0 {
+			source = prices.FileSource{Path: pricesPath}
+		}
+		interval := time.Hour
+		if len(pricesInterval) > 0 {
+			interval, err = time.ParseDuration(pricesInterval)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		job, err := postgres.NewPriceJob(ctx, postgresConnector, source)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := job.Import(ctx); err != nil {
+			log.Fatal(err)
+		}
+		go job.Run(ctx, interval)
+	}
+
+	// blocks are also written to secondary database, its failures skip the block there unless mode is `all`
+	var backend processorTypes.Processor = db
+	if len(secondaryConnector) > 0 {
+		secondary, err := postgres.NewProcessor(ctx, secondaryConnector, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := secondary.WarmChannelCache(ctx); err != nil {
+			log.Fatal(err)
+		}
+		mode := multi.BestEffort
+		if secondaryMode == "all" {
+			mode = multi.AllMustSucceed
+		}
+		backend = multi.NewProcessor(mode, db, secondary)
+	}
+
+	processor := processor.NewProcessor(ctx, blocks, backend)
 
 	err = processor.Process(ctx)
 
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/mapofzones/txs-processor/pkg/x/postgres"
+)
+
+// recalculates stats of transfers over channels whose close time became known
+// and adds parked transfers over channels which can be resolved now
+func main() {
+	postgresConnector := os.Getenv("postgres")
+	excludeClosedChannels, _ := strconv.ParseBool(os.Getenv("exclude_closed_channels"))
+
+	ctx := context.Background()
+
+	db, err := postgres.NewProcessor(ctx, postgresConnector, postgres.WithClosedChannelsExcluded(excludeClosedChannels))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rows, err := db.ReconcilePendingTransfers(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("reconciled pending ibc transfers stats rows: ", rows)
+
+	rows, err = db.RecalculateClosedChannelStats(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("recalculated closed channel stats rows: ", rows)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mapofzones/txs-processor/pkg/prices"
+	"github.com/mapofzones/txs-processor/pkg/x/postgres"
+)
+
+// imports corrected prices and recalculates usd and display amounts of hourly stats during [from, to),
+// longer periods are recalculated by rollup job of the processor
+func main() {
+	postgresConnector := os.Getenv("postgres")
+	pricesPath := os.Getenv("prices")
+	from, err := time.Parse(time.RFC3339, os.Getenv("from"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := time.Parse(time.RFC3339, os.Getenv("to"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	var source prices.Source
+	if len(pricesPath) > 0 {
+		source = prices.FileSource{Path: pricesPath}
+	}
+	job, err := postgres.NewPriceJob(ctx, postgresConnector, source)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := job.Import(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if err := job.Reprice(ctx, from.UTC().Truncate(time.Hour), to.UTC()); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("repriced hourly stats from", from, "to", to)
+}
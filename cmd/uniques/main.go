@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mapofzones/txs-processor/pkg/x/postgres"
+)
+
+// prints approximate number of distinct addresses of the zone with the role active during [from, to),
+// it is counted from hourly sketches of active addresses
+func main() {
+	postgresConnector := os.Getenv("postgres")
+	zone := os.Getenv("zone")
+	role := os.Getenv("role")
+	if len(role) == 0 {
+		role = postgres.RoleAll
+	}
+	from, err := time.Parse(postgres.Format, os.Getenv("from"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err := time.Parse(postgres.Format, os.Getenv("to"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	db, err := postgres.NewProcessor(ctx, postgresConnector)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	count, err := db.UniqueAddresses(ctx, zone, role, from, to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("unique addresses: ", count)
+}
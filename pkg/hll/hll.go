@@ -0,0 +1,100 @@
+// Package hll implements HyperLogLog sketches used to approximately count distinct addresses
+package hll
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Precision is a number of hash bits used to pick a register
+const Precision = 12
+
+// Size is a number of registers in a sketch, each register is one byte
+const Size = 1 << Precision
+
+// Sketch estimates the number of distinct values added to it,
+// sketches are merged by taking maximum of each register
+type Sketch struct {
+	registers [Size]byte
+}
+
+// New returns empty sketch
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// FromBytes restores sketch from its registers
+func FromBytes(data []byte) (*Sketch, error) {
+	if len(data) != Size {
+		return nil, fmt.Errorf("hll: expected %d registers, got %d", Size, len(data))
+	}
+	s := &Sketch{}
+	copy(s.registers[:], data)
+	return s, nil
+}
+
+// Bytes returns registers of the sketch
+func (s *Sketch) Bytes() []byte {
+	data := make([]byte, Size)
+	copy(data, s.registers[:])
+	return data
+}
+
+// Add adds value to the sketch
+func (s *Sketch) Add(value []byte) {
+	x := hash(value)
+	index := x >> (64 - Precision)
+	// the lowest bit guarantees the rank fits into remaining bits
+	rank := byte(bits.LeadingZeros64(x<<Precision|1<<(Precision-1)) + 1)
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// AddString adds string value to the sketch
+func (s *Sketch) AddString(value string) {
+	s.Add([]byte(value))
+}
+
+// Merge adds all values of other sketch to this one
+func (s *Sketch) Merge(other *Sketch) {
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Count returns estimated number of distinct values added to the sketch
+func (s *Sketch) Count() uint64 {
+	sum := 0.0
+	zeros := 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	m := float64(Size)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small cardinalities are estimated better by linear counting
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// hash is FNV-1a with splitmix64 finalizer, FNV alone does not mix short similar values well
+func hash(value []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(value)
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,62 @@
+package hll
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketch_Count(t *testing.T) {
+	tests := []struct {
+		name     string
+		distinct int
+	}{
+		{"empty", 0},
+		{"one", 1},
+		{"small", 100},
+		{"medium", 10000},
+		{"large", 1000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			for i := 0; i < tt.distinct; i++ {
+				s.AddString(fmt.Sprintf("cosmos1address%d", i))
+				// duplicates do not change the estimate
+				s.AddString(fmt.Sprintf("cosmos1address%d", i))
+			}
+			assert.InDelta(t, tt.distinct, s.Count(), float64(tt.distinct)*0.05)
+		})
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	first, second, union := New(), New(), New()
+	for i := 0; i < 20000; i++ {
+		address := fmt.Sprintf("osmo1address%d", i)
+		if i < 15000 {
+			first.AddString(address)
+		}
+		if i >= 5000 {
+			second.AddString(address)
+		}
+		union.AddString(address)
+	}
+
+	first.Merge(second)
+	assert.Equal(t, union.Bytes(), first.Bytes())
+	assert.InDelta(t, 20000, first.Count(), 20000*0.05)
+}
+
+func TestFromBytes(t *testing.T) {
+	s := New()
+	s.AddString("cosmos1address")
+
+	restored, err := FromBytes(s.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, s, restored)
+
+	_, err = FromBytes([]byte{1, 2, 3})
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+// Package prices provides hourly USD prices of denoms
+package prices
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Price is USD price of one display unit of base denom during the hour
+type Price struct {
+	Denom string    `json:"denom"`
+	Hour  time.Time `json:"hour"`
+	USD   float64   `json:"usd"`
+}
+
+// Source provides prices, it is called every time prices are imported,
+// so corrected prices of past hours are picked up
+type Source interface {
+	Prices(ctx context.Context) ([]Price, error)
+}
+
+// FileSource reads prices from CSV file with `denom,hour,usd` rows,
+// or from JSON file with a list of prices if file has .json extension
+type FileSource struct {
+	Path string
+}
+
+// Prices reads all prices from file, hours are truncated
+func (s FileSource) Prices(ctx context.Context) ([]Price, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var prices []Price
+	if strings.EqualFold(filepath.Ext(s.Path), ".json") {
+		prices, err = readJSON(file)
+	} else {
+		prices, err = readCSV(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("prices: %s: %w", s.Path, err)
+	}
+	for i := range prices {
+		prices[i].Hour = prices[i].Hour.UTC().Truncate(time.Hour)
+	}
+	return prices, nil
+}
+
+func readJSON(r io.Reader) ([]Price, error) {
+	var prices []Price
+	if err := json.NewDecoder(r).Decode(&prices); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// readCSV skips header if the file has one
+func readCSV(r io.Reader) ([]Price, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make([]Price, 0, len(records))
+	for i, record := range records {
+		if i == 0 && record[0] == "denom" {
+			continue
+		}
+		hour, err := time.Parse(time.RFC3339, record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		usd, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		prices = append(prices, Price{Denom: record[0], Hour: hour, USD: usd})
+	}
+	return prices, nil
+}
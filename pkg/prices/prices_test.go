@@ -0,0 +1,51 @@
+package prices
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSource_Prices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prices")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hour := time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	expected := []Price{
+		{Denom: "uatom", Hour: hour, USD: 12.5},
+		{Denom: "uosmo", Hour: hour.Add(time.Hour), USD: 4.25},
+	}
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr bool
+	}{
+		{"csv", "prices.csv", "denom,hour,usd\nuatom,2021-07-01T10:00:00Z,12.5\nuosmo,2021-07-01T11:15:00Z,4.25\n", false},
+		{"csv_without_header", "prices.csv", "uatom, 2021-07-01T10:00:00Z, 12.5\nuosmo, 2021-07-01T13:15:00+02:00, 4.25\n", false},
+		{"json", "prices.json", `[{"denom": "uatom", "hour": "2021-07-01T10:00:00Z", "usd": 12.5}, {"denom": "uosmo", "hour": "2021-07-01T11:30:00Z", "usd": 4.25}]`, false},
+		{"invalid_price", "prices.csv", "uatom,2021-07-01T10:00:00Z,twelve\n", true},
+		{"invalid_hour", "prices.csv", "uatom,yesterday,12.5\n", true},
+		{"invalid_json", "prices.json", `[{"denom": "uatom"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			assert.NoError(t, ioutil.WriteFile(path, []byte(tt.data), 0644))
+
+			actual, err := FileSource{Path: path}.Prices(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
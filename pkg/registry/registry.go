@@ -0,0 +1,254 @@
+// Package registry loads zone metadata from chain-registry-style directory or JSON file
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Asset is a denom native to the zone
+type Asset struct {
+	Base     string `json:"base"`
+	Display  string `json:"display"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+	LogoURL  string `json:"logo_url"`
+}
+
+// Chain is zone metadata
+type Chain struct {
+	ChainID      string  `json:"chain_id"`
+	ChainName    string  `json:"chain_name"`
+	PrettyName   string  `json:"pretty_name"`
+	Bech32Prefix string  `json:"bech32_prefix"`
+	LogoURL      string  `json:"logo_url"`
+	Assets       []Asset `json:"assets"`
+}
+
+// Name returns name zone is displayed by
+func (c Chain) Name() string {
+	if len(c.PrettyName) > 0 {
+		return c.PrettyName
+	}
+	if len(c.ChainName) > 0 {
+		return c.ChainName
+	}
+	return c.ChainID
+}
+
+// Denom describes how base units of denom are displayed
+type Denom struct {
+	Denom    string `json:"denom"`
+	Display  string `json:"display"`
+	Exponent int    `json:"exponent"`
+}
+
+// LoadDenoms reads JSON file with a list of denoms
+func LoadDenoms(path string) ([]Denom, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var denoms []Denom
+	if err := json.Unmarshal(data, &denoms); err != nil {
+		return nil, fmt.Errorf("registry: %s: %w", path, err)
+	}
+	return denoms, nil
+}
+
+// Registry holds zone metadata by chain id, it can be reloaded while it is used
+type Registry struct {
+	path string
+
+	mu      sync.RWMutex
+	chains  map[string]Chain
+	version uint64
+}
+
+// Load reads registry from path, it is either a directory with <chain>/chain.json
+// and <chain>/assetlist.json files like in chain-registry, or a JSON file with a list of chains
+func Load(path string) (*Registry, error) {
+	r := &Registry{path: path}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads registry again, registry is not changed if it can not be read
+func (r *Registry) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	var chains []Chain
+	if info.IsDir() {
+		chains, err = readDir(r.path)
+	} else {
+		chains, err = readFile(r.path)
+	}
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]Chain, len(chains))
+	for _, chain := range chains {
+		if len(chain.ChainID) > 0 {
+			byID[chain.ChainID] = chain
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chains = byID
+	r.version++
+	return nil
+}
+
+// Version is incremented on every reload
+func (r *Registry) Version() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// Chain returns metadata of the zone
+func (r *Registry) Chain(chainID string) (Chain, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	chain, ok := r.chains[chainID]
+	return chain, ok
+}
+
+// Chains returns metadata of all zones
+func (r *Registry) Chains() []Chain {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	chains := make([]Chain, 0, len(r.chains))
+	for _, chain := range r.chains {
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// Denoms returns display units of assets of all zones
+func (r *Registry) Denoms() []Denom {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var denoms []Denom
+	for _, chain := range r.chains {
+		for _, asset := range chain.Assets {
+			denoms = append(denoms, Denom{Denom: asset.Base, Display: asset.Display, Exponent: asset.Decimals})
+		}
+	}
+	return denoms
+}
+
+func readFile(path string) ([]Chain, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chains []Chain
+	if err := json.Unmarshal(data, &chains); err != nil {
+		return nil, fmt.Errorf("registry: %s: %w", path, err)
+	}
+	return chains, nil
+}
+
+// chain.json and assetlist.json as they are in chain-registry, only used fields are listed
+type chainFile struct {
+	ChainID      string   `json:"chain_id"`
+	ChainName    string   `json:"chain_name"`
+	PrettyName   string   `json:"pretty_name"`
+	Bech32Prefix string   `json:"bech32_prefix"`
+	LogoURIs     logoURIs `json:"logo_URIs"`
+}
+
+type assetListFile struct {
+	Assets []struct {
+		Base       string `json:"base"`
+		Display    string `json:"display"`
+		Symbol     string `json:"symbol"`
+		DenomUnits []struct {
+			Denom    string `json:"denom"`
+			Exponent int    `json:"exponent"`
+		} `json:"denom_units"`
+		LogoURIs logoURIs `json:"logo_URIs"`
+	} `json:"assets"`
+}
+
+type logoURIs struct {
+	PNG string `json:"png"`
+	SVG string `json:"svg"`
+}
+
+func (l logoURIs) url() string {
+	if len(l.PNG) > 0 {
+		return l.PNG
+	}
+	return l.SVG
+}
+
+func readDir(path string) ([]Chain, error) {
+	dirs, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var chains []Chain
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(path, dir.Name(), "chain.json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var file chainFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("registry: %s/chain.json: %w", dir.Name(), err)
+		}
+		chain := Chain{
+			ChainID:      file.ChainID,
+			ChainName:    file.ChainName,
+			PrettyName:   file.PrettyName,
+			Bech32Prefix: file.Bech32Prefix,
+			LogoURL:      file.LogoURIs.url(),
+		}
+
+		data, err = ioutil.ReadFile(filepath.Join(path, dir.Name(), "assetlist.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var assets assetListFile
+			if err := json.Unmarshal(data, &assets); err != nil {
+				return nil, fmt.Errorf("registry: %s/assetlist.json: %w", dir.Name(), err)
+			}
+			for _, asset := range assets.Assets {
+				decimals := 0
+				for _, unit := range asset.DenomUnits {
+					if unit.Denom == asset.Display {
+						decimals = unit.Exponent
+					}
+				}
+				chain.Assets = append(chain.Assets, Asset{
+					Base:     asset.Base,
+					Display:  asset.Display,
+					Symbol:   asset.Symbol,
+					Decimals: decimals,
+					LogoURL:  asset.LogoURIs.url(),
+				})
+			}
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
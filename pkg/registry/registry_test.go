@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const chainJSON = `{
+  "chain_name": "cosmoshub",
+  "chain_id": "cosmoshub-4",
+  "pretty_name": "Cosmos Hub",
+  "bech32_prefix": "cosmos",
+  "logo_URIs": {"svg": "https://example.com/atom.svg"}
+}`
+
+const assetListJSON = `{
+  "chain_name": "cosmoshub",
+  "assets": [{
+    "base": "uatom",
+    "display": "atom",
+    "symbol": "ATOM",
+    "denom_units": [{"denom": "uatom", "exponent": 0}, {"denom": "atom", "exponent": 6}],
+    "logo_URIs": {"png": "https://example.com/atom.png"}
+  }]
+}`
+
+var cosmoshub = Chain{
+	ChainID:      "cosmoshub-4",
+	ChainName:    "cosmoshub",
+	PrettyName:   "Cosmos Hub",
+	Bech32Prefix: "cosmos",
+	LogoURL:      "https://example.com/atom.svg",
+	Assets:       []Asset{{Base: "uatom", Display: "atom", Symbol: "ATOM", Decimals: 6, LogoURL: "https://example.com/atom.png"}},
+}
+
+func writeFile(t *testing.T, path, data string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0644))
+}
+
+func TestLoad_Directory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, filepath.Join(dir, "cosmoshub", "chain.json"), chainJSON)
+	writeFile(t, filepath.Join(dir, "cosmoshub", "assetlist.json"), assetListJSON)
+	writeFile(t, filepath.Join(dir, "_IBC", "cosmoshub-osmosis.json"), `{}`)
+	writeFile(t, filepath.Join(dir, "README.md"), "not a chain")
+
+	r, err := Load(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Chain{cosmoshub}, r.Chains())
+	assert.Equal(t, []Denom{{Denom: "uatom", Display: "atom", Exponent: 6}}, r.Denoms())
+	assert.Equal(t, uint64(1), r.Version())
+}
+
+func TestLoad_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zones.json")
+	writeFile(t, path, `[{"chain_id": "osmosis-1", "pretty_name": "Osmosis", "bech32_prefix": "osmo",
+		"assets": [{"base": "uosmo", "display": "osmo", "symbol": "OSMO", "decimals": 6}]}]`)
+
+	r, err := Load(path)
+	assert.NoError(t, err)
+	chain, ok := r.Chain("osmosis-1")
+	assert.True(t, ok)
+	assert.Equal(t, Chain{
+		ChainID:      "osmosis-1",
+		PrettyName:   "Osmosis",
+		Bech32Prefix: "osmo",
+		Assets:       []Asset{{Base: "uosmo", Display: "osmo", Symbol: "OSMO", Decimals: 6}},
+	}, chain)
+
+	_, ok = r.Chain("cosmoshub-4")
+	assert.False(t, ok)
+
+	// broken file does not replace loaded registry
+	writeFile(t, path, `[{"chain_id": `)
+	assert.Error(t, r.Reload())
+	assert.Equal(t, uint64(1), r.Version())
+	_, ok = r.Chain("osmosis-1")
+	assert.True(t, ok)
+
+	writeFile(t, path, `[{"chain_id": "cosmoshub-4", "pretty_name": "Cosmos Hub"}]`)
+	assert.NoError(t, r.Reload())
+	assert.Equal(t, uint64(2), r.Version())
+	_, ok = r.Chain("osmosis-1")
+	assert.False(t, ok)
+}
+
+func TestLoadDenoms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "denoms.json")
+	writeFile(t, path, `[{"denom": "aevmos", "display": "evmos", "exponent": 18}, {"denom": "uatom", "display": "atom", "exponent": 6}]`)
+
+	denoms, err := LoadDenoms(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []Denom{{Denom: "aevmos", Display: "evmos", Exponent: 18}, {Denom: "uatom", Display: "atom", Exponent: 6}}, denoms)
+
+	_, err = LoadDenoms(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestChain_Name(t *testing.T) {
+	assert.Equal(t, "Cosmos Hub", cosmoshub.Name())
+	assert.Equal(t, "cosmoshub", Chain{ChainID: "cosmoshub-4", ChainName: "cosmoshub"}.Name())
+	assert.Equal(t, "cosmoshub-4", Chain{ChainID: "cosmoshub-4"}.Name())
+}
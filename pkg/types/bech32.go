@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// reasons why address is not counted as active
+const (
+	InvalidAddressEmpty  = "empty"
+	InvalidAddressBech32 = "invalid_bech32"
+	InvalidAddressPrefix = "wrong_prefix"
+)
+
+// ValidateAddress returns lowercase address and its raw bytes if it is a valid bech32 address
+// with expected prefix, empty prefix accepts any, otherwise it returns the reason address is invalid
+func ValidateAddress(address, prefix string) (string, []byte, string) {
+	if len(address) == 0 {
+		return "", nil, InvalidAddressEmpty
+	}
+	// mixed case addresses are not valid bech32, but the case does not change address bytes
+	address = strings.ToLower(address)
+	hrp, payload, err := DecodeBech32(address)
+	if err != nil {
+		return "", nil, InvalidAddressBech32
+	}
+	if len(prefix) > 0 && hrp != strings.ToLower(prefix) {
+		return "", nil, InvalidAddressPrefix
+	}
+	return address, payload, ""
+}
+
+// DecodeBech32 returns human readable part and raw bytes of bech32 address,
+// the same key has the same bytes on every zone regardless of the address prefix
+func DecodeBech32(address string) (string, []byte, error) {
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return "", nil, errors.New("bech32: mixed case address")
+	}
+	address = strings.ToLower(address)
+
+	separator := strings.LastIndexByte(address, '1')
+	if separator < 1 || separator+7 > len(address) {
+		return "", nil, fmt.Errorf("bech32: invalid separator position in %s", address)
+	}
+	hrp := address[:separator]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("bech32: invalid character in prefix of %s", address)
+		}
+	}
+
+	data := make([]byte, 0, len(address)-separator-1)
+	for _, c := range address[separator+1:] {
+		value := strings.IndexRune(bech32Charset, c)
+		if value < 0 {
+			return "", nil, fmt.Errorf("bech32: invalid character %q in %s", c, address)
+		}
+		data = append(data, byte(value))
+	}
+	if bech32Polymod(append(bech32HrpExpand(hrp), data...)) != 1 {
+		return "", nil, fmt.Errorf("bech32: invalid checksum of %s", address)
+	}
+
+	payload, err := convertBits(data[:len(data)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, payload, nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits regroups bits of data from groups of fromBits to groups of toBits
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxValue := uint32(1)<<toBits - 1
+	converted := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, value := range data {
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			converted = append(converted, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, errors.New("bech32: invalid padding")
+	}
+	return converted, nil
+}
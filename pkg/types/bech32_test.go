@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeBech32 is used to build addresses of the same key with different prefixes
+func encodeBech32(hrp string, payload []byte) string {
+	data, _ := convertBits(payload, 8, 5, true)
+	values := append(bech32HrpExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+	for i := 0; i < 6; i++ {
+		data = append(data, byte(polymod>>uint(5*(5-i))&31))
+	}
+	address := hrp + "1"
+	for _, value := range data {
+		address += string(bech32Charset[value])
+	}
+	return address
+}
+
+func TestDecodeBech32(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		hrp     string
+		payload []byte
+		wantErr bool
+	}{
+		{"empty_payload", "a12uel5l", "a", []byte{}, false},
+		{"upper_case", "A12UEL5L", "a", []byte{}, false},
+		{
+			"full_charset",
+			"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+			"abcdef",
+			[]byte{0x00, 0x44, 0x32, 0x14, 0xc7, 0x42, 0x54, 0xb6, 0x35, 0xcf, 0x84, 0x65, 0x3a, 0x56, 0xd7, 0xc6, 0x75, 0xbe, 0x77, 0xdf},
+			false,
+		},
+		{"mixed_case", "A12uEL5L", "", nil, true},
+		{"empty_hrp", "10a06t8", "", nil, true},
+		{"no_separator", "pzry9x0s0muk", "", nil, true},
+		{"invalid_character", "x1b4n0q5v", "", nil, true},
+		{"invalid_checksum", "a12uel5m", "", nil, true},
+		{"short_checksum", "abc1rzg", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hrp, payload, err := DecodeBech32(tt.address)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.hrp, hrp)
+			assert.Equal(t, tt.payload, payload)
+		})
+	}
+}
+
+func TestDecodeBech32_SameKeyOnDifferentZones(t *testing.T) {
+	key := []byte{0x9b, 0x3c, 0x2f, 0x61, 0x07, 0xd4, 0x1a, 0x8e, 0x55, 0x10, 0xc2, 0x7f, 0x03, 0xee, 0x48, 0x91, 0x6a, 0x2d, 0xb0, 0x34}
+
+	hrp, cosmos, err := DecodeBech32(encodeBech32("cosmos", key))
+	assert.NoError(t, err)
+	assert.Equal(t, "cosmos", hrp)
+
+	hrp, osmo, err := DecodeBech32(encodeBech32("osmo", key))
+	assert.NoError(t, err)
+	assert.Equal(t, "osmo", hrp)
+
+	assert.Equal(t, key, cosmos)
+	assert.Equal(t, cosmos, osmo)
+}
+
+func TestValidateAddress(t *testing.T) {
+	key := []byte{0x9b, 0x3c, 0x2f, 0x61, 0x07, 0xd4, 0x1a, 0x8e, 0x55, 0x10, 0xc2, 0x7f, 0x03, 0xee, 0x48, 0x91, 0x6a, 0x2d, 0xb0, 0x34}
+	address := encodeBech32("cosmos", key)
+	tests := []struct {
+		name       string
+		address    string
+		prefix     string
+		normalized string
+		payload    []byte
+		reason     string
+	}{
+		{"valid", address, "cosmos", address, key, ""},
+		{"any_prefix", address, "", address, key, ""},
+		{"upper_case", strings.ToUpper(address), "cosmos", address, key, ""},
+		{"mixed_case", "Cosmos" + address[6:], "cosmos", address, key, ""},
+		{"wrong_prefix", address, "osmo", "", nil, InvalidAddressPrefix},
+		{"invalid_checksum", address[:len(address)-1] + "q", "cosmos", "", nil, InvalidAddressBech32},
+		{"not_bech32", "moz:kfdjf928hfjvnczmnvsohvyuqoefiudb", "", "", nil, InvalidAddressBech32},
+		{"empty", "", "cosmos", "", nil, InvalidAddressEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, payload, reason := ValidateAddress(tt.address, tt.prefix)
+			assert.Equal(t, tt.normalized, normalized)
+			assert.Equal(t, tt.payload, payload)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
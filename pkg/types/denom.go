@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// TransferPort is the ICS-20 port used by ibc transfers
+const TransferPort = "transfer"
+
+// DenomTrace describes ibc voucher denom and the path it came to the zone by
+type DenomTrace struct {
+	IbcDenom  string
+	Path      string
+	BaseDenom string
+	// Origin is the zone on the other side of the first channel in the path
+	Origin string
+}
+
+// NewDenomTrace returns trace of the voucher minted when base denom is received via given transfer channel
+func NewDenomTrace(channelID, baseDenom, origin string) DenomTrace {
+	path := fmt.Sprintf("%s/%s", TransferPort, channelID)
+	return DenomTrace{
+		IbcDenom:  IBCDenom(path, baseDenom),
+		Path:      path,
+		BaseDenom: baseDenom,
+		Origin:    origin,
+	}
+}
+
+// IBCDenom returns ICS-20 voucher denom, it is a hash of the full denom path
+func IBCDenom(path, baseDenom string) string {
+	hash := sha256.Sum256([]byte(path + "/" + baseDenom))
+	return "ibc/" + strings.ToUpper(fmt.Sprintf("%x", hash))
+}
+
+// IsBaseDenom reports whether denom is not a voucher or a denom path,
+// native denoms may contain slashes too, e.g. gamm/pool/1
+func IsBaseDenom(denom string) bool {
+	return !strings.HasPrefix(denom, "ibc/") && UnwoundDenom(denom) == denom
+}
+
+// UnwoundDenom returns denom without the first hop of its path,
+// tokens returning to their origin arrive with the path of the sender side
+func UnwoundDenom(denom string) string {
+	parts := strings.SplitN(denom, "/", 3)
+	if len(parts) != 3 || parts[0] != TransferPort {
+		return denom
+	}
+	return parts[2]
+}
+
+// BaseDenom returns denom without all hops of its path,
+// vouchers are returned as is because their path is only known from denom traces
+func BaseDenom(denom string) string {
+	for {
+		unwound := UnwoundDenom(denom)
+		if unwound == denom {
+			return denom
+		}
+		denom = unwound
+	}
+}
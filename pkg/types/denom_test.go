@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDenomTrace(t *testing.T) {
+	tests := []struct {
+		name      string
+		channelID string
+		baseDenom string
+		origin    string
+		expected  DenomTrace
+	}{
+		{
+			"atom_on_osmosis",
+			"channel-0",
+			"uatom",
+			"cosmoshub-4",
+			DenomTrace{"ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", "transfer/channel-0", "uatom", "cosmoshub-4"},
+		},
+		{
+			"osmo_on_cosmoshub",
+			"channel-141",
+			"uosmo",
+			"osmosis-1",
+			DenomTrace{"ibc/14F9BC3E44B8A9C1BE1FB08980FAB87034C9905EF17CF2F5008FC085218811CC", "transfer/channel-141", "uosmo", "osmosis-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewDenomTrace(tt.channelID, tt.baseDenom, tt.origin))
+		})
+	}
+}
+
+func TestIsBaseDenom(t *testing.T) {
+	assert.True(t, IsBaseDenom("uatom"))
+	assert.False(t, IsBaseDenom("ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"))
+	assert.False(t, IsBaseDenom("transfer/channel-0/uatom"))
+	assert.True(t, IsBaseDenom("gamm/pool/1"))
+	assert.True(t, IsBaseDenom("factory/osmo1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5helwsw/x"))
+}
+
+func TestUnwoundDenom(t *testing.T) {
+	tests := []struct {
+		denom    string
+		expected string
+	}{
+		{"uatom", "uatom"},
+		{"transfer/channel-141/uatom", "uatom"},
+		{"transfer/channel-141/transfer/channel-0/uosmo", "transfer/channel-0/uosmo"},
+		{"ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.denom, func(t *testing.T) {
+			assert.Equal(t, tt.expected, UnwoundDenom(tt.denom))
+		})
+	}
+}
+
+func TestBaseDenom(t *testing.T) {
+	tests := []struct {
+		denom    string
+		expected string
+	}{
+		{"uatom", "uatom"},
+		{"transfer/channel-141/uatom", "uatom"},
+		{"transfer/channel-141/transfer/channel-0/uosmo", "uosmo"},
+		{"ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2", "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.denom, func(t *testing.T) {
+			assert.Equal(t, tt.expected, BaseDenom(tt.denom))
+		})
+	}
+}
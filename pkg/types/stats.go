@@ -10,6 +10,18 @@ type AddressData struct {
 	IsInternalTx       bool
 	IsInternalTransfer bool
 	IsExternalTransfer bool
+	// address received coins by transfer inside the zone
+	IsInternalReceive bool
+	// address received coins by ibc transfer from another zone
+	IsExternalReceive bool
+	// Payload is raw address bytes without the zone prefix, empty unless addresses are decoded
+	Payload []byte
+}
+
+// IsCounterparty reports whether address is only a sender of received ibc transfers,
+// such address belongs to the counterparty zone
+func (a AddressData) IsCounterparty() bool {
+	return a.IsExternalTransfer && !a.IsInternalTx && !a.IsInternalTransfer && !a.IsInternalReceive && !a.IsExternalReceive
 }
 
 // TxStats structure is used to see how many txs were send during each hour
@@ -20,7 +32,99 @@ type TxStats struct {
 	TxWithIBCTransfer     int
 	TxWithIBCTransferFail int
 	Addresses             []*AddressData
-	TurnoverAmount        *big.Int
+	// addresses indexed by address, used to merge duplicates
+	addressIndex map[string]*AddressData
+	// TurnoverAmount is a sum of all coins regardless of denom, kept for compatibility
+	TurnoverAmount *big.Int
+	// Turnover holds amounts per denom
+	Turnover map[string]*big.Int
+	// InvalidAddresses counts addresses which were not added to active ones
+	InvalidAddresses map[InvalidAddress]int
+}
+
+// InvalidAddress is an address which failed validation and the reason it failed
+type InvalidAddress struct {
+	Address string
+	Reason  string
+}
+
+// AddInvalidAddress counts address which failed validation
+func (s *TxStats) AddInvalidAddress(address, reason string) {
+	if s.InvalidAddresses == nil {
+		s.InvalidAddresses = make(map[InvalidAddress]int)
+	}
+	s.InvalidAddresses[InvalidAddress{Address: address, Reason: reason}]++
+}
+
+// AddAddress adds address to the stats, if the address is already there
+// its flags are merged with the existing ones
+func (s *TxStats) AddAddress(address AddressData) {
+	if s.addressIndex == nil {
+		s.addressIndex = make(map[string]*AddressData, len(s.Addresses))
+		for _, existing := range s.Addresses {
+			s.addressIndex[existing.Address] = existing
+		}
+	}
+
+	if existing, ok := s.addressIndex[address.Address]; ok {
+		existing.IsInternalTx = existing.IsInternalTx || address.IsInternalTx
+		existing.IsInternalTransfer = existing.IsInternalTransfer || address.IsInternalTransfer
+		existing.IsExternalTransfer = existing.IsExternalTransfer || address.IsExternalTransfer
+		existing.IsInternalReceive = existing.IsInternalReceive || address.IsInternalReceive
+		existing.IsExternalReceive = existing.IsExternalReceive || address.IsExternalReceive
+		if existing.Payload == nil {
+			existing.Payload = address.Payload
+		}
+		return
+	}
+	s.Addresses = append(s.Addresses, &address)
+	s.addressIndex[address.Address] = &address
+}
+
+// AddTurnover adds coins to the per denom turnover and to the legacy total
+func (s *TxStats) AddTurnover(coins []struct {
+	Amount *big.Int
+	Coin   string
+}) {
+	if s.TurnoverAmount == nil {
+		s.TurnoverAmount = big.NewInt(0)
+	}
+	if s.Turnover == nil {
+		s.Turnover = make(map[string]*big.Int)
+	}
+
+	for _, coin := range coins {
+		s.TurnoverAmount.Add(s.TurnoverAmount, coin.Amount)
+		value := s.Turnover[coin.Coin]
+		if value == nil {
+			value = new(big.Int)
+			s.Turnover[coin.Coin] = value
+		}
+		value.Add(value, coin.Amount)
+	}
+}
+
+// MessageCounters counts messages of one type, failed ones are in rejected txs
+type MessageCounters struct {
+	Count       int
+	FailedCount int
+}
+
+// MessageStats counts messages by their type
+type MessageStats map[string]*MessageCounters
+
+// Add counts message of given type
+func (m *MessageStats) Add(msgType string, failed bool) {
+	if *m == nil {
+		*m = make(MessageStats)
+	}
+	if (*m)[msgType] == nil {
+		(*m)[msgType] = &MessageCounters{}
+	}
+	(*m)[msgType].Count++
+	if failed {
+		(*m)[msgType].FailedCount++
+	}
 }
 
 // IbcStats represents statistics that we need to write to db
@@ -33,6 +137,19 @@ type IbcStats struct {
 	FailedCount int
 }
 
+// PendingIbcTransfer is an ibc transfer over the channel whose counterparty zone is not known yet
+type PendingIbcTransfer struct {
+	Channel string
+	Hour    time.Time //must have 0 minutes, seconds and micro/nano seconds
+	Source  bool
+	Failed  bool
+	TxHash  string
+	Amount  []struct {
+		Amount *big.Int
+		Coin   string
+	}
+}
+
 type IbcCounters struct {
 	Transfers       int
 	FailedTransfers int
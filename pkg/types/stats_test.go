@@ -168,3 +168,95 @@ func TestIbcData_ToIbcStats(t *testing.T) {
 		})
 	}
 }
+
+func TestTxStats_AddTurnover(t *testing.T) {
+	coins := []struct {
+		Amount *big.Int
+		Coin   string
+	}{
+		{Amount: big.NewInt(100), Coin: "uatom"},
+		{Amount: big.NewInt(25), Coin: "ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"},
+		{Amount: big.NewInt(7), Coin: "uatom"},
+	}
+	tests := []struct {
+		name             string
+		stats            TxStats
+		expectedTotal    *big.Int
+		expectedTurnover map[string]*big.Int
+	}{
+		{
+			"empty_stats",
+			TxStats{},
+			big.NewInt(132),
+			map[string]*big.Int{
+				"uatom": big.NewInt(107),
+				"ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2": big.NewInt(25),
+			},
+		},
+		{
+			"existing_stats",
+			TxStats{TurnoverAmount: big.NewInt(10), Turnover: map[string]*big.Int{"uatom": big.NewInt(3), "uosmo": big.NewInt(7)}},
+			big.NewInt(142),
+			map[string]*big.Int{
+				"uatom": big.NewInt(110),
+				"uosmo": big.NewInt(7),
+				"ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2": big.NewInt(25),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.stats.AddTurnover(coins)
+			assert.Equal(t, tt.expectedTotal, tt.stats.TurnoverAmount)
+			assert.Equal(t, tt.expectedTurnover, tt.stats.Turnover)
+		})
+	}
+}
+
+func TestTxStats_AddAddress(t *testing.T) {
+	stats := TxStats{Addresses: []*AddressData{{Address: "cosmos1existing", IsInternalTx: true}}}
+	stats.AddAddress(AddressData{Address: "cosmos1sender", IsInternalTx: true})
+	stats.AddAddress(AddressData{Address: "cosmos1sender", IsExternalTransfer: true})
+	stats.AddAddress(AddressData{Address: "cosmos1existing", IsInternalTransfer: true})
+	stats.AddAddress(AddressData{Address: "cosmos1sender", IsInternalTx: true})
+	stats.AddAddress(AddressData{Address: "cosmos1recipient", IsInternalReceive: true})
+	stats.AddAddress(AddressData{Address: "cosmos1recipient", IsExternalReceive: true, Payload: []byte{0x01}})
+
+	assert.Equal(t, []*AddressData{
+		{Address: "cosmos1existing", IsInternalTx: true, IsInternalTransfer: true},
+		{Address: "cosmos1sender", IsInternalTx: true, IsExternalTransfer: true},
+		{Address: "cosmos1recipient", IsInternalReceive: true, IsExternalReceive: true, Payload: []byte{0x01}},
+	}, stats.Addresses)
+}
+
+func TestAddressData_IsCounterparty(t *testing.T) {
+	assert.True(t, AddressData{Address: "osmo1sender", IsExternalTransfer: true}.IsCounterparty())
+	assert.False(t, AddressData{Address: "cosmos1sender", IsExternalTransfer: true, IsInternalTx: true}.IsCounterparty())
+	assert.False(t, AddressData{Address: "cosmos1recipient", IsExternalReceive: true}.IsCounterparty())
+}
+
+func TestTxStats_AddInvalidAddress(t *testing.T) {
+	stats := TxStats{}
+	stats.AddInvalidAddress("", InvalidAddressEmpty)
+	stats.AddInvalidAddress("osmo1wrong", InvalidAddressPrefix)
+	stats.AddInvalidAddress("", InvalidAddressEmpty)
+
+	assert.Equal(t, map[InvalidAddress]int{
+		{Address: "", Reason: InvalidAddressEmpty}:            2,
+		{Address: "osmo1wrong", Reason: InvalidAddressPrefix}: 1,
+	}, stats.InvalidAddresses)
+}
+
+func TestMessageStats_Add(t *testing.T) {
+	var stats MessageStats
+	stats.Add("Transaction", false)
+	stats.Add("Transfer", false)
+	stats.Add("Transaction", true)
+	stats.Add("IBCTransfer", true)
+
+	assert.Equal(t, MessageStats{
+		"Transaction": {Count: 2, FailedCount: 1},
+		"Transfer":    {Count: 1, FailedCount: 0},
+		"IBCTransfer": {Count: 1, FailedCount: 1},
+	}, stats)
+}
@@ -0,0 +1,171 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+
+	watcher "github.com/mapofzones/cosmos-watcher/pkg/types"
+	processor "github.com/mapofzones/txs-processor/pkg/types"
+)
+
+// compile time check
+var _ processor.Processor = &MultiProcessor{}
+
+// blocks which secondaries missed and skipped on resync, keyed by backend index and chain id,
+// published by expvar at /debug/vars of the default http mux
+var missedBlocks = expvar.NewMap("secondary_missed_blocks")
+
+// Mode defines how errors of the wrapped backends affect block processing
+type Mode int
+
+const (
+	// AllMustSucceed rejects the block if any backend fails, it is not atomic:
+	// backends are committed one by one and the ones committed before the failed one are not rolled back,
+	// so a secondary which failed the commit is resynced on the next block and misses the failed one
+	AllMustSucceed Mode = iota
+	// BestEffort rejects the block only if the primary backend fails,
+	// errors of secondary backends are logged and the backend skips the block
+	BestEffort
+)
+
+// Resetter is implemented by backends which gather block data until commit,
+// Reset drops data of the block the backend is not going to commit
+type Resetter interface {
+	Reset()
+}
+
+// Resyncer is implemented by backends which can continue from a later block than they expect,
+// Resync moves the backend to the block and returns number of blocks it misses
+type Resyncer interface {
+	Resync(ctx context.Context, b watcher.Block) (int64, error)
+}
+
+// MultiProcessor fans every block out to several backends
+// the first backend is the primary one, the rest are secondaries
+type MultiProcessor struct {
+	mode     Mode
+	backends []processor.Processor
+	// secondaries which failed during current block and must not receive the rest of it
+	skipped map[int]bool
+}
+
+// NewProcessor returns instance of composite processor
+func NewProcessor(mode Mode, primary processor.Processor, secondaries ...processor.Processor) *MultiProcessor {
+	return &MultiProcessor{
+		mode:     mode,
+		backends: append([]processor.Processor{primary}, secondaries...),
+		skipped:  make(map[int]bool),
+	}
+}
+
+// Validate runs validation of every backend, secondaries which are behind are resynced
+// to the block, otherwise they would never get a block at height they expect
+func (p *MultiProcessor) Validate(ctx context.Context, b watcher.Block) error {
+	p.skipped = make(map[int]bool)
+	for i, backend := range p.backends {
+		err := backend.Validate(ctx, b)
+		if i > 0 && errors.Is(err, processor.BlockHeightError) {
+			err = p.resync(ctx, i, b, err)
+		}
+		if err := p.check(i, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resync moves lagging secondary to the block and validates it again
+func (p *MultiProcessor) resync(ctx context.Context, i int, b watcher.Block, err error) error {
+	r, ok := p.backends[i].(Resyncer)
+	if !ok {
+		return err
+	}
+	missed, resyncErr := r.Resync(ctx, b)
+	if resyncErr != nil {
+		return fmt.Errorf("%s: could not resync: %w", err.Error(), resyncErr)
+	}
+	if missed <= 0 {
+		// backend is ahead, it already has the block
+		return err
+	}
+	log.Printf("secondary backend %d misses %d blocks of %s before height %d\n", i, missed, b.ChainID(), b.Height())
+	missedBlocks.Add(fmt.Sprintf("%d/%s", i, b.ChainID()), missed)
+	return p.backends[i].Validate(ctx, b)
+}
+
+// Handler combines handlers of all backends into one
+func (p *MultiProcessor) Handler(msg watcher.Message) func(context.Context, processor.MessageMetadata, watcher.Message) error {
+	handlers := make(map[int]func(context.Context, processor.MessageMetadata, watcher.Message) error)
+	for i, backend := range p.backends {
+		if p.skipped[i] {
+			continue
+		}
+		if handler := backend.Handler(msg); handler != nil {
+			handlers[i] = handler
+		}
+	}
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	return func(ctx context.Context, metadata processor.MessageMetadata, msg watcher.Message) error {
+		for i := range p.backends {
+			handler, ok := handlers[i]
+			if !ok || p.skipped[i] {
+				continue
+			}
+			if err := p.check(i, handler(ctx, metadata, msg)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Commit commits block to every backend, primary goes first
+// backends are committed one by one, so with AllMustSucceed a failure
+// of a later backend does not roll back the ones already committed
+func (p *MultiProcessor) Commit(ctx context.Context, b watcher.Block) error {
+	defer func() { p.skipped = make(map[int]bool) }()
+
+	for i, backend := range p.backends {
+		if p.skipped[i] {
+			continue
+		}
+		if err := p.check(i, backend.Commit(ctx, b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check decides whether error of the given backend must be returned
+func (p *MultiProcessor) check(i int, err error) error {
+	if err == nil {
+		return nil
+	}
+	if i == 0 || p.mode == AllMustSucceed {
+		// block is rejected, none of the backends commits it
+		for j := range p.backends {
+			p.reset(j)
+		}
+		if i > 0 {
+			return fmt.Errorf("backend %d: %w", i, err)
+		}
+		return err
+	}
+	log.Printf("secondary backend %d skips block: %s\n", i, err)
+	p.skipped[i] = true
+	p.reset(i)
+	return nil
+}
+
+// reset drops block data gathered by the backend if it supports that
+func (p *MultiProcessor) reset(i int) {
+	if r, ok := p.backends[i].(Resetter); ok {
+		r.Reset()
+	}
+}
@@ -0,0 +1,126 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	watcher "github.com/mapofzones/cosmos-watcher/pkg/types"
+	processor "github.com/mapofzones/txs-processor/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProcessor struct {
+	validateErr error
+	handleErr   error
+	commitErr   error
+	handled     int
+	committed   int
+	resets      int
+}
+
+func (f *fakeProcessor) Reset() {
+	f.resets++
+}
+
+func (f *fakeProcessor) Validate(context.Context, watcher.Block) error {
+	return f.validateErr
+}
+
+func (f *fakeProcessor) Handler(watcher.Message) func(context.Context, processor.MessageMetadata, watcher.Message) error {
+	return func(context.Context, processor.MessageMetadata, watcher.Message) error {
+		f.handled++
+		return f.handleErr
+	}
+}
+
+func (f *fakeProcessor) Commit(context.Context, watcher.Block) error {
+	f.committed++
+	return f.commitErr
+}
+
+func process(p *MultiProcessor, block watcher.Block, msg watcher.Message) error {
+	ctx := context.Background()
+	if err := p.Validate(ctx, block); err != nil {
+		return err
+	}
+	if err := p.Handler(msg)(ctx, processor.MessageMetadata{}, msg); err != nil {
+		return err
+	}
+	return p.Commit(ctx, block)
+}
+
+func TestMultiProcessor(t *testing.T) {
+	failure := errors.New("failure")
+	tests := []struct {
+		name              string
+		mode              Mode
+		primary           *fakeProcessor
+		secondary         *fakeProcessor
+		expectedErr       bool
+		expectedHandled   int
+		expectedCommitted int
+		expectedResets    int
+	}{
+		{"all_succeed", AllMustSucceed, &fakeProcessor{}, &fakeProcessor{}, false, 1, 1, 0},
+		{"all_secondary_handle_fails", AllMustSucceed, &fakeProcessor{}, &fakeProcessor{handleErr: failure}, true, 1, 0, 1},
+		{"all_secondary_commit_fails", AllMustSucceed, &fakeProcessor{}, &fakeProcessor{commitErr: failure}, true, 1, 1, 1},
+		{"best_effort_secondary_validate_fails", BestEffort, &fakeProcessor{}, &fakeProcessor{validateErr: failure}, false, 0, 0, 1},
+		{"best_effort_secondary_handle_fails", BestEffort, &fakeProcessor{}, &fakeProcessor{handleErr: failure}, false, 1, 0, 1},
+		{"best_effort_secondary_commit_fails", BestEffort, &fakeProcessor{}, &fakeProcessor{commitErr: failure}, false, 1, 1, 1},
+		{"best_effort_primary_fails", BestEffort, &fakeProcessor{validateErr: failure}, &fakeProcessor{}, true, 0, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(tt.mode, tt.primary, tt.secondary)
+			var block watcher.Block
+			err := process(p, block, watcher.Transaction{})
+			assert.Equal(t, tt.expectedErr, err != nil)
+			assert.True(t, errors.Is(err, failure) || err == nil)
+			assert.Equal(t, tt.expectedHandled, tt.secondary.handled)
+			assert.Equal(t, tt.expectedCommitted, tt.secondary.committed)
+			assert.Equal(t, tt.expectedResets, tt.secondary.resets)
+			assert.Empty(t, p.skipped)
+		})
+	}
+}
+
+type laggingProcessor struct {
+	fakeProcessor
+	missed int64
+}
+
+func (l *laggingProcessor) Resync(context.Context, watcher.Block) (int64, error) {
+	if l.missed > 0 {
+		l.validateErr = nil
+	}
+	return l.missed, nil
+}
+
+func TestMultiProcessor_resync(t *testing.T) {
+	heightErr := fmt.Errorf("%w: expected block at height 2", processor.BlockHeightError)
+	tests := []struct {
+		name              string
+		secondary         *laggingProcessor
+		expectedCommitted int
+		expectedMissed    string
+	}{
+		{"behind", &laggingProcessor{fakeProcessor{validateErr: heightErr}, 3}, 1, "3"},
+		{"ahead", &laggingProcessor{fakeProcessor{validateErr: heightErr}, 0}, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missedBlocks.Init()
+			p := NewProcessor(BestEffort, &fakeProcessor{}, tt.secondary)
+			var block watcher.Block
+			assert.NoError(t, process(p, block, watcher.Transaction{}))
+			assert.Equal(t, tt.expectedCommitted, tt.secondary.committed)
+			if len(tt.expectedMissed) > 0 {
+				assert.Equal(t, tt.expectedMissed, missedBlocks.Get("1/"+block.ChainID()).String())
+			} else {
+				assert.Nil(t, missedBlocks.Get("1/"+block.ChainID()))
+			}
+		})
+	}
+}
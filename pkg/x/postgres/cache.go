@@ -0,0 +1,72 @@
+package postgres
+
+import "container/list"
+
+type channelKey struct {
+	zone    string
+	channel string
+}
+
+type channelEntry struct {
+	key  channelKey
+	info ChannelInfo
+}
+
+// channelCache is a bounded LRU cache of channels and their counterparty chains,
+// unlike block data it is kept between blocks
+type channelCache struct {
+	size  int
+	items map[channelKey]*list.Element
+	order *list.List
+}
+
+func newChannelCache(size int) *channelCache {
+	return &channelCache{
+		size:  size,
+		items: make(map[channelKey]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Get returns info of the channel and marks it as recently used
+func (c *channelCache) Get(zone, channel string) (ChannelInfo, bool) {
+	item, ok := c.items[channelKey{zone, channel}]
+	if !ok {
+		return ChannelInfo{}, false
+	}
+	c.order.MoveToFront(item)
+	return item.Value.(*channelEntry).info, true
+}
+
+// Add puts info of the channel to the cache evicting least recently used one if cache is full
+func (c *channelCache) Add(zone, channel string, info ChannelInfo) {
+	if c.size <= 0 {
+		return
+	}
+	key := channelKey{zone, channel}
+	if item, ok := c.items[key]; ok {
+		item.Value.(*channelEntry).info = info
+		c.order.MoveToFront(item)
+		return
+	}
+	c.items[key] = c.order.PushFront(&channelEntry{key, info})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*channelEntry).key)
+	}
+}
+
+// Remove drops the channel from the cache
+func (c *channelCache) Remove(zone, channel string) {
+	key := channelKey{zone, channel}
+	if item, ok := c.items[key]; ok {
+		c.order.Remove(item)
+		delete(c.items, key)
+	}
+}
+
+// Len returns number of cached channels
+func (c *channelCache) Len() int {
+	return c.order.Len()
+}
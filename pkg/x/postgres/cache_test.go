@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_channelCache(t *testing.T) {
+	cache := newChannelCache(2)
+	cache.Add("zone1", "channel-0", ChannelInfo{"connection-0", "07-tendermint-0", "chain1", true, false})
+	cache.Add("zone1", "channel-1", ChannelInfo{"connection-1", "07-tendermint-1", "chain2", true, false})
+
+	// touch channel-0, so channel-1 becomes least recently used
+	info, ok := cache.Get("zone1", "channel-0")
+	assert.True(t, ok)
+	assert.Equal(t, "chain1", info.ChainID)
+
+	cache.Add("zone2", "channel-0", ChannelInfo{"connection-0", "07-tendermint-0", "chain3", false, false})
+	assert.Equal(t, 2, cache.Len())
+	_, ok = cache.Get("zone1", "channel-1")
+	assert.False(t, ok)
+	info, ok = cache.Get("zone2", "channel-0")
+	assert.True(t, ok)
+	assert.Equal(t, ChannelInfo{"connection-0", "07-tendermint-0", "chain3", false, false}, info)
+
+	cache.Remove("zone1", "channel-0")
+	_, ok = cache.Get("zone1", "channel-0")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func Test_channelCacheDisabled(t *testing.T) {
+	cache := newChannelCache(0)
+	cache.Add("zone1", "channel-0", ChannelInfo{ChainID: "chain1"})
+	_, ok := cache.Get("zone1", "channel-0")
+	assert.False(t, ok)
+}
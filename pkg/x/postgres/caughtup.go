@@ -0,0 +1,51 @@
+package postgres
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// CaughtUpJob unmarks caught up zones which sent no blocks for longer than threshold,
+// processor marks them again once their blocks are committed in time
+type CaughtUpJob struct {
+	conn      *pgx.Conn
+	threshold time.Duration
+}
+
+// NewCaughtUpJob returns instance of caught up job with its own db connection
+func NewCaughtUpJob(ctx context.Context, dbEndpoint string, threshold time.Duration) (*CaughtUpJob, error) {
+	conn, err := pgx.Connect(ctx, dbEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &CaughtUpJob{
+		conn:      conn,
+		threshold: threshold,
+	}, nil
+}
+
+// Run checks zones every interval until context is done
+func (j *CaughtUpJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := j.MarkStale(ctx); err != nil {
+				log.Println("could not mark stale zones:", err)
+			}
+		case <-ctx.Done():
+			j.conn.Close(context.Background())
+			return
+		}
+	}
+}
+
+// MarkStale unmarks zones whose last block is older than threshold
+func (j *CaughtUpJob) MarkStale(ctx context.Context) error {
+	_, err := j.conn.Exec(ctx, markStaleZones(time.Now().Add(-j.threshold)))
+	return err
+}
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// metrics are published by expvar at /debug/vars of the default http mux,
+// they are evaluated on every read, so lag keeps growing while a zone sends no blocks
+var lastBlocks = &zoneBlocks{blocks: make(map[string]zoneBlock)}
+
+func init() {
+	expvar.Publish("zone_lag_seconds", expvar.Func(lastBlocks.lags))
+	expvar.Publish("zone_caught_up", expvar.Func(lastBlocks.caughtUp))
+}
+
+type zoneBlock struct {
+	time      time.Time
+	threshold time.Duration
+}
+
+// zoneBlocks keeps time of the last committed block of every zone, it is read by http server
+type zoneBlocks struct {
+	sync.Mutex
+	blocks map[string]zoneBlock
+	now    func() time.Time
+}
+
+func (z *zoneBlocks) record(chainID string, blockTime time.Time, threshold time.Duration) {
+	z.Lock()
+	defer z.Unlock()
+	z.blocks[chainID] = zoneBlock{time: blockTime, threshold: threshold}
+}
+
+func (z *zoneBlocks) since(t time.Time) time.Duration {
+	if z.now != nil {
+		return z.now().Sub(t)
+	}
+	return time.Since(t)
+}
+
+// lags returns seconds passed since the last committed block of each zone
+func (z *zoneBlocks) lags() interface{} {
+	z.Lock()
+	defer z.Unlock()
+	lags := make(map[string]float64, len(z.blocks))
+	for chainID, b := range z.blocks {
+		lags[chainID] = z.since(b.time).Seconds()
+	}
+	return lags
+}
+
+// caughtUp returns 1 for zones whose lag is below threshold and 0 otherwise,
+// zones are published only if threshold is set
+func (z *zoneBlocks) caughtUp() interface{} {
+	z.Lock()
+	defer z.Unlock()
+	caughtUp := make(map[string]int)
+	for chainID, b := range z.blocks {
+		if b.threshold <= 0 {
+			continue
+		}
+		caughtUp[chainID] = 0
+		if z.since(b.time) < b.threshold {
+			caughtUp[chainID] = 1
+		}
+	}
+	return caughtUp
+}
+
+// recordLag publishes time of the last committed block of the zone
+func (p *PostgresProcessor) recordLag(chainID string, blockTime time.Time) {
+	lastBlocks.record(chainID, blockTime, p.caughtUpThreshold)
+}
@@ -19,36 +19,37 @@ func (p *PostgresProcessor) handleTransaction(ctx context.Context, metadata proc
 
 	if p.txStats == nil {
 		p.txStats = &processor.TxStats{
-			ChainID: metadata.ChainID,
-			Hour:    metadata.BlockTime.Truncate(time.Hour),
+			ChainID:        metadata.ChainID,
+			Hour:           metadata.BlockTime.Truncate(time.Hour),
 			TurnoverAmount: big.NewInt(0),
 		}
 	}
 
-	// addresses collection logic
-	if len(msg.Sender) > 0 {
-		address := &processor.AddressData{
-			Address:            msg.Sender,
-			IsInternalTx:       true,
-			IsInternalTransfer: false,
-			IsExternalTransfer: false,
-		}
-		p.txStats.Addresses = append(p.txStats.Addresses, address)
-	} else {
-		log.Println("Not found sender for tx!")
-	}
+	// addresses collection logic, txs without sender are counted as invalid addresses
+	p.addAddress(processor.AddressData{
+		Address:            msg.Sender,
+		IsInternalTx:       true,
+		IsInternalTransfer: false,
+		IsExternalTransfer: false,
+	})
 
-	// if tx had errors and did not affect the state
+	// if tx had errors and did not affect the state, only its transfers are counted as failed on their channels
 	if !metadata.TxMetadata.Accepted {
 		p.txStats.Count++
+		hasIBCTransfers := false
 		for _, m := range msg.Messages {
+			p.messageStats.Add(messageType(m), true)
 			if message, ok := m.(watcher.IBCTransfer); ok {
-				p.txStats.TxWithIBCTransferFail++
-				p.txStats.TxWithIBCTransfer++
-				p.handleIBCTransfer(ctx, metadata, message)
-				return nil
+				hasIBCTransfers = true
+				if err := p.handleIBCTransfer(ctx, metadata, message); err != nil {
+					return err
+				}
 			}
 		}
+		if hasIBCTransfers {
+			p.txStats.TxWithIBCTransferFail++
+			p.txStats.TxWithIBCTransfer++
+		}
 		return nil
 	}
 
@@ -59,32 +60,58 @@ func (p *PostgresProcessor) handleTransaction(ctx context.Context, metadata proc
 	hasIBCTransfers := false
 	// process each tx message
 	for _, m := range msg.Messages {
-		if _, ok := m.(watcher.IBCTransfer); ok {
+		if transfer, ok := m.(watcher.IBCTransfer); ok {
 			hasIBCTransfers = true
-			for _, am := range m.(watcher.IBCTransfer).Amount {
-				p.txStats.TurnoverAmount.Add(p.txStats.TurnoverAmount, am.Amount)
+			p.txStats.AddTurnover(transfer.Amount)
+			// channel is resolved once for the sender prefix and for the transfer stats
+			channel, err := p.ChannelInfo(ctx, transfer.ChannelID, metadata.ChainID)
+			if err != nil {
+				return fmt.Errorf("%w: %s", processor.ConnectionError, err.Error())
 			}
-			address := &processor.AddressData{
-				Address:            m.(watcher.IBCTransfer).Sender,
+			address := processor.AddressData{
+				Address:            transfer.Sender,
 				IsInternalTx:       false,
-				IsInternalTransfer: m.(watcher.IBCTransfer).Source,
-				IsExternalTransfer: !m.(watcher.IBCTransfer).Source,
+				IsInternalTransfer: transfer.Source,
+				IsExternalTransfer: !transfer.Source,
+			}
+			// sender of received transfer is an address of the counterparty chain,
+			// only bech32 is checked if the counterparty is not known yet
+			prefix := p.addressPrefix(metadata.ChainID)
+			if !transfer.Source {
+				prefix = ""
+				if len(channel.ChainID) > 0 {
+					prefix = p.addressPrefix(channel.ChainID)
+				}
+			}
+			p.addAddressWithPrefix(address, prefix)
+			log.Println(transfer.Sender)
+			// recipient is on this zone only if transfer was received
+			if !transfer.Source && len(transfer.Recipient) > 0 {
+				p.addAddress(processor.AddressData{
+					Address:           transfer.Recipient,
+					IsExternalReceive: true,
+				})
 			}
-			p.txStats.Addresses = append(p.txStats.Addresses, address)
-			log.Println(m.(watcher.IBCTransfer).Sender)
+			p.messageStats.Add(messageType(m), false)
+			p.countChannelTransfer(metadata, transfer, channel)
+			continue
 		}
 		if _, ok := m.(watcher.Transfer); ok {
-			for _, am := range m.(watcher.Transfer).Amount {
-				p.txStats.TurnoverAmount.Add(p.txStats.TurnoverAmount, am.Amount)
-			}
-			address := &processor.AddressData{
+			p.txStats.AddTurnover(m.(watcher.Transfer).Amount)
+			address := processor.AddressData{
 				Address:            m.(watcher.Transfer).Sender,
 				IsInternalTx:       true,
 				IsInternalTransfer: false,
 				IsExternalTransfer: false,
 			}
-			p.txStats.Addresses = append(p.txStats.Addresses, address)
+			p.addAddress(address)
 			log.Println(m.(watcher.Transfer).Sender)
+			if len(m.(watcher.Transfer).Recipient) > 0 {
+				p.addAddress(processor.AddressData{
+					Address:           m.(watcher.Transfer).Recipient,
+					IsInternalReceive: true,
+				})
+			}
 		}
 		handle := p.Handler(m)
 		if handle != nil {
@@ -127,29 +154,121 @@ func (p *PostgresProcessor) handleOpenChannel(ctx context.Context, metadata proc
 
 func (p *PostgresProcessor) handleCloseChannel(ctx context.Context, metadata processor.MessageMetadata, msg watcher.CloseChannel) error {
 	p.channelStates[msg.ChannelID] = false
+	p.closedChannels[msg.ChannelID] = metadata.BlockTime
 	return nil
 }
 
+// handleIBCTransfer counts transfer on the channel it was sent or received by,
+// failed transfers are the ones whose tx was rejected on this zone: packet sequence,
+// acknowledgements and timeouts are not delivered by the watcher, so packets can not
+// be tracked until they are delivered to the counterparty, nor can the sending and
+// the receiving sides of a transfer be matched to measure its latency
 func (p *PostgresProcessor) handleIBCTransfer(ctx context.Context, metadata processor.MessageMetadata, msg watcher.IBCTransfer) error {
-	chainID, err := p.ChainID(ctx, msg.ChannelID, metadata.ChainID)
+	channel, err := p.ChannelInfo(ctx, msg.ChannelID, metadata.ChainID)
 	if err != nil {
 		return fmt.Errorf("%w: %s", processor.ConnectionError, err.Error())
 	}
+	p.countChannelTransfer(metadata, msg, channel)
+	return nil
+}
+
+// countChannelTransfer counts transfer on its resolved channel, transfers over unknown channels are parked
+func (p *PostgresProcessor) countChannelTransfer(metadata processor.MessageMetadata, msg watcher.IBCTransfer, channel ChannelInfo) {
+	chainID := channel.ChainID
+
+	// channel was created before the zone was indexed, park transfer until channel is known
 	if chainID == "" {
-		return fmt.Errorf("%w: could not fetch chainID connected to given channelID", processor.CommitError)
+		p.pendingIbc = append(p.pendingIbc, processor.PendingIbcTransfer{
+			Channel: msg.ChannelID,
+			Hour:    metadata.BlockTime.Truncate(time.Hour),
+			Source:  msg.Source,
+			Failed:  !metadata.TxMetadata.Accepted,
+			TxHash:  metadata.TxMetadata.Hash,
+			Amount:  msg.Amount,
+		})
+		return
 	}
 
-	isEnabledChannel, err := p.GetChannelStatus(ctx, msg.ChannelID, metadata.ChainID)
-	if err != nil || isEnabledChannel == false {
-		//return fmt.Errorf("%w: could not process ibc transfer with closed channelID", processor.CommitError)
-		//todo: need to recalculate statistics for frozen transfer txs and resolve the issue of transactions to closed channels
+	p.countIbcTransfer(metadata.ChainID, chainID, metadata.BlockTime, channel.IsClosed, !metadata.TxMetadata.Accepted, msg)
+}
+
+// countIbcTransfer counts transfer of the zone on its channel to the counterparty chain,
+// parked transfers are counted by it as well once their channel is resolved,
+// denom traces and supply are kept for closed channels even if their stats are excluded
+func (p *PostgresProcessor) countIbcTransfer(origin, counterparty string, t time.Time, closed, failed bool, msg watcher.IBCTransfer) {
+	if !msg.Source && !failed {
+		p.addDenomTraces(msg.ChannelID, counterparty, msg.Amount)
+	}
+	if closed {
+		if msg.Source {
+			p.closedIbcStats.Append(origin, counterparty, t, msg.ChannelID, failed, msg.Amount)
+		} else {
+			p.closedIbcStats.Append(counterparty, origin, t, msg.ChannelID, failed, msg.Amount)
+		}
+		if p.excludeClosedChannels {
+			return
+		}
 	}
 
 	if msg.Source {
-		p.ibcStats.Append(metadata.ChainID, chainID, metadata.BlockTime, msg.ChannelID, !metadata.TxMetadata.Accepted, msg.Amount)
+		p.ibcStats.Append(origin, counterparty, t, msg.ChannelID, failed, msg.Amount)
 	} else {
-		p.ibcStats.Append(chainID, metadata.ChainID, metadata.BlockTime, msg.ChannelID, !metadata.TxMetadata.Accepted, msg.Amount)
+		p.ibcStats.Append(counterparty, origin, t, msg.ChannelID, failed, msg.Amount)
 	}
+}
 
-	return nil
+// supplyIbcStats returns ibc stats which move channel supply, transfers over closed channels
+// are only in closed channel stats if they are excluded from the regular ones
+func (p *PostgresProcessor) supplyIbcStats() []processor.IbcData {
+	if p.excludeClosedChannels {
+		return []processor.IbcData{p.ibcStats, p.closedIbcStats}
+	}
+	return []processor.IbcData{p.ibcStats}
+}
+
+// addDenomTraces remembers vouchers minted on the zone for received coins,
+// denoms with a transfer path are not traced because they can not be told apart from tokens
+// returning to their origin without knowing the counterparty channel
+func (p *PostgresProcessor) addDenomTraces(channelID, origin string, coins []struct {
+	Amount *big.Int
+	Coin   string
+}) {
+	for _, coin := range coins {
+		if !processor.IsBaseDenom(coin.Coin) {
+			continue
+		}
+		trace := processor.NewDenomTrace(channelID, coin.Coin, origin)
+		p.denomTraces[trace.IbcDenom] = trace
+	}
+}
+
+// addAddress adds lowercase address to tx stats if it is valid bech32 address of the zone,
+// otherwise it is counted as invalid, raw bytes are kept if decoding is enabled
+func (p *PostgresProcessor) addAddress(address processor.AddressData) {
+	p.addAddressWithPrefix(address, p.addressPrefix(p.txStats.ChainID))
+}
+
+// addAddressWithPrefix adds address which is expected to have the given prefix, empty prefix is not checked
+func (p *PostgresProcessor) addAddressWithPrefix(address processor.AddressData, prefix string) {
+	normalized, payload, reason := processor.ValidateAddress(address.Address, prefix)
+	if len(reason) > 0 {
+		p.txStats.AddInvalidAddress(address.Address, reason)
+		return
+	}
+	address.Address = normalized
+	if p.decodeAddresses {
+		address.Payload = payload
+	}
+	p.txStats.AddAddress(address)
+}
+
+// addressPrefix returns expected bech32 prefix of zone addresses, configured prefixes take precedence over registry
+func (p *PostgresProcessor) addressPrefix(chainID string) string {
+	if prefix, ok := p.addressPrefixes[chainID]; ok {
+		return prefix
+	}
+	if chain, ok := p.registryChain(chainID); ok {
+		return chain.Bech32Prefix
+	}
+	return ""
 }
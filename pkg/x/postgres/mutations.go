@@ -1,42 +1,149 @@
 package postgres
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	watcher "github.com/mapofzones/cosmos-watcher/pkg/types"
+	"github.com/mapofzones/txs-processor/pkg/hll"
+	"github.com/mapofzones/txs-processor/pkg/prices"
+	"github.com/mapofzones/txs-processor/pkg/registry"
 	processor "github.com/mapofzones/txs-processor/pkg/types"
 )
 
-func addZone(chainID string) string {
-	return fmt.Sprintf(addZoneQuery,
-		fmt.Sprintf("('%s', '%s', %t, %t)", chainID, chainID, true, false),
-		true,
-	)
+// chainLookup returns registry metadata of the chain if the registry knows it
+type chainLookup func(chainID string) (registry.Chain, bool)
+
+func addZone(chainID string, lookup chainLookup) string {
+	return fmt.Sprintf(addZoneQuery, zoneValues(chainID, true, lookup), true)
 }
 
-func addImplicitZones(clients map[string]string) string {
-	query := ""
+func addImplicitZones(clients map[string]string, lookup chainLookup) string {
+	chainIDs := make([]string, 0, len(clients))
 	for _, chainID := range clients {
 		if len(chainID) > 0 {
-			query += fmt.Sprintf("('%s', '%s', %t, %t),", chainID, chainID, false, false)
+			chainIDs = append(chainIDs, chainID)
+		}
+	}
+	if len(chainIDs) == 0 {
+		return ""
+	}
+	sort.Strings(chainIDs)
+	values := make([]string, 0, len(chainIDs))
+	for _, chainID := range chainIDs {
+		values = append(values, zoneValues(chainID, false, lookup))
+	}
+	return fmt.Sprintf(addImplicitZoneQuery, strings.Join(values, ","))
+}
+
+// zoneValues returns row of the new zone, zones unknown to the registry are named by their chain id
+func zoneValues(chainID string, isEnabled bool, lookup chainLookup) string {
+	if chain, ok := lookup(chainID); ok {
+		return fmt.Sprintf("('%s', '%s', %t, %t, '%s', '%s', '%s'::jsonb)",
+			escape(chain.Name()), chainID, isEnabled, false, escape(chain.Bech32Prefix), escape(chain.LogoURL), escape(nativeDenoms(chain)))
+	}
+	return fmt.Sprintf("('%s', '%s', %t, %t, null, null, null)", chainID, chainID, isEnabled, false)
+}
+
+type nativeDenom struct {
+	Denom    string `json:"denom"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+func nativeDenoms(chain registry.Chain) string {
+	denoms := make([]nativeDenom, 0, len(chain.Assets))
+	for _, asset := range chain.Assets {
+		denoms = append(denoms, nativeDenom{Denom: asset.Base, Symbol: asset.Symbol, Decimals: asset.Decimals})
+	}
+	// marshalling of strings and ints does not fail
+	data, _ := json.Marshal(denoms)
+	return string(data)
+}
+
+// updateZonesMetadata updates metadata of zones known to the registry and clears it for the ones it does not know anymore
+func updateZonesMetadata(chains []registry.Chain) []string {
+	sort.Slice(chains, func(i, j int) bool { return chains[i].ChainID < chains[j].ChainID })
+	values := make([]string, 0, len(chains))
+	chainIDs := make([]string, 0, len(chains))
+	for _, chain := range chains {
+		values = append(values, fmt.Sprintf("('%s', '%s', '%s', '%s', '%s')",
+			escape(chain.ChainID), escape(chain.Name()), escape(chain.Bech32Prefix), escape(chain.LogoURL), escape(nativeDenoms(chain))))
+		chainIDs = append(chainIDs, fmt.Sprintf("'%s'", escape(chain.ChainID)))
+	}
+	queries := []string{fmt.Sprintf(clearZonesMetadataQuery, strings.Join(chainIDs, ","))}
+	if len(values) > 0 {
+		queries = append(queries, fmt.Sprintf(updateZonesMetadataQuery, strings.Join(values, ", ")))
+	}
+	return queries
+}
+
+// addDenomMetadata upserts display units of denoms, the last one wins if denom is listed more than once
+func addDenomMetadata(denoms []registry.Denom) string {
+	byDenom := make(map[string]registry.Denom, len(denoms))
+	for _, denom := range denoms {
+		if len(denom.Denom) > 0 {
+			byDenom[denom.Denom] = denom
 		}
 	}
-	result := ""
-	if len(query) > 0 {
-		query = query[:len(query)-1]
-		result = fmt.Sprintf(addImplicitZoneQuery, query)
+	if len(byDenom) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(byDenom))
+	for key := range byDenom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, fmt.Sprintf("('%s', '%s', %d)", escape(key), escape(byDenom[key].Display), byDenom[key].Exponent))
 	}
-	return result
+	return fmt.Sprintf(addDenomMetadataQuery, strings.Join(values, ", "))
 }
 
-func markBlock(chainID string) string {
-	t := time.Now().Format(Format)
-	return markBlockConstruct(chainID, t)
+// escape makes string from outside of the zone safe to use in sql literal
+func escape(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
 }
 
-func markBlockConstruct(chainID string, t string) string {
+func markBlock(chainID string, now, blockTime time.Time) string {
+	return markBlockConstruct(chainID, now.Format(Format), blockTime.UTC().Format(PreciseFormat))
+}
+
+func markBlockConstruct(chainID string, t string, blockTime string) string {
 	return fmt.Sprintf(markBlockQuery,
-		fmt.Sprintf("('%s', %d, '%s')", chainID, 1, t), t)
+		fmt.Sprintf("('%s', %d, '%s', '%s')", chainID, 1, t, blockTime), t, blockTime)
+}
+
+func resyncBlock(chainID string, height int64) string {
+	return fmt.Sprintf(resyncBlockQuery, chainID, height)
+}
+
+func markCaughtUp(chainID string, caughtUp bool) string {
+	return fmt.Sprintf(markCaughtUpQuery, chainID, caughtUp)
+}
+
+func markStaleZones(cutoff time.Time) string {
+	return fmt.Sprintf(markStaleZonesQuery, cutoff.UTC().Format(PreciseFormat))
+}
+
+// addBlockStats counts txs and messages of the block, messages inside txs are counted instead of txs themselves
+func addBlockStats(block watcher.Block) string {
+	txs, msgs := 0, 0
+	for _, msg := range block.Messages() {
+		if tx, ok := msg.(watcher.Transaction); ok {
+			txs++
+			msgs += len(tx.Messages)
+			continue
+		}
+		msgs++
+	}
+	return fmt.Sprintf(addBlockStatsQuery, block.ChainID(), block.Height(), block.Time().UTC().Format(PreciseFormat), txs, msgs)
 }
 
 func addTxStats(stats processor.TxStats) string {
@@ -50,21 +157,113 @@ func addTxStats(stats processor.TxStats) string {
 	)
 }
 
-func addActiveAddressesStats(stats processor.TxStats, addressData processor.AddressData) string {
+func addTxTurnover(stats processor.TxStats) string {
+	values := ""
+	for denom, amount := range stats.Turnover {
+		values += fmt.Sprintf("('%s', timestamp '%s', %d, '%s', %d::numeric, '%s'),", stats.ChainID, stats.Hour.Format(Format), 1, denom, amount, processor.BaseDenom(denom))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(addTxTurnoverQuery, values[:len(values)-1])
+}
+
+func addInvalidAddresses(stats processor.TxStats) string {
+	values := make([]string, 0, len(stats.InvalidAddresses))
+	for address, count := range stats.InvalidAddresses {
+		values = append(values, fmt.Sprintf("('%s', '%s', '%s', '%s', %d)",
+			stats.ChainID, stats.Hour.Format(Format), escape(address.Address), address.Reason, count))
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(addInvalidAddressesQuery, strings.Join(values, ", "))
+}
+
+func addActiveAddressesStats(stats processor.TxStats) string {
+	if len(stats.Addresses) == 0 {
+		return ""
+	}
+	addresses := make([]string, 0, len(stats.Addresses))
+	internalTxs := make([]string, 0, len(stats.Addresses))
+	internalTransfers := make([]string, 0, len(stats.Addresses))
+	externalTransfers := make([]string, 0, len(stats.Addresses))
+	internalReceives := make([]string, 0, len(stats.Addresses))
+	externalReceives := make([]string, 0, len(stats.Addresses))
+	payloads := make([]string, 0, len(stats.Addresses))
+	for _, address := range stats.Addresses {
+		addresses = append(addresses, fmt.Sprintf("'%s'", address.Address))
+		internalTxs = append(internalTxs, fmt.Sprintf("%t", address.IsInternalTx))
+		internalTransfers = append(internalTransfers, fmt.Sprintf("%t", address.IsInternalTransfer))
+		externalTransfers = append(externalTransfers, fmt.Sprintf("%t", address.IsExternalTransfer))
+		internalReceives = append(internalReceives, fmt.Sprintf("%t", address.IsInternalReceive))
+		externalReceives = append(externalReceives, fmt.Sprintf("%t", address.IsExternalReceive))
+		if len(address.Payload) > 0 {
+			payloads = append(payloads, fmt.Sprintf("'\\x%x'", address.Payload))
+		} else {
+			payloads = append(payloads, "null")
+		}
+	}
 	return fmt.Sprintf(addActiveAddressesQuery,
-		fmt.Sprintf(
-			"('%s', '%s', '%s', %d, %t, %t, %t)",
-			addressData.Address,
-			stats.ChainID,
-			stats.Hour.Format(Format),
-			1,
-			addressData.IsInternalTx,
-			addressData.IsInternalTransfer,
-			addressData.IsExternalTransfer,
-		),
+		stats.ChainID,
+		stats.Hour.Format(Format),
+		1,
+		strings.Join(addresses, ","),
+		strings.Join(internalTxs, ","),
+		strings.Join(internalTransfers, ","),
+		strings.Join(externalTransfers, ","),
+		strings.Join(internalReceives, ","),
+		strings.Join(externalReceives, ","),
+		strings.Join(payloads, ","),
 	)
 }
 
+// addNewAddresses counts addresses of the zone seen for the first time, counterparty senders are not its addresses
+func addNewAddresses(stats processor.TxStats) string {
+	addresses := make([]string, 0, len(stats.Addresses))
+	for _, address := range stats.Addresses {
+		if !address.IsCounterparty() {
+			addresses = append(addresses, fmt.Sprintf("'%s'", address.Address))
+		}
+	}
+	if len(addresses) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(addNewAddressesQuery, stats.ChainID, stats.Hour.Format(Format), strings.Join(addresses, ","))
+}
+
+func addAddressSketches(chainID string, hour time.Time, period Period, sketches map[string]*hll.Sketch) string {
+	if len(sketches) == 0 {
+		return ""
+	}
+	roles := make([]string, 0, len(sketches))
+	for role := range sketches {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	values := make([]string, 0, len(sketches))
+	for _, role := range roles {
+		values = append(values, fmt.Sprintf("('%s', '%s', %d, '%s', '\\x%x')", chainID, hour.Format(Format), period, role, sketches[role].Bytes()))
+	}
+	return fmt.Sprintf(addAddressSketchesQuery, strings.Join(values, ", "))
+}
+func addMessageStats(origin string, blockTime time.Time, stats processor.MessageStats) string {
+	if len(stats) == 0 {
+		return ""
+	}
+	types := make([]string, 0, len(stats))
+	for msgType := range stats {
+		types = append(types, msgType)
+	}
+	sort.Strings(types)
+	values := make([]string, 0, len(stats))
+	for _, msgType := range types {
+		values = append(values, fmt.Sprintf("('%s', '%s', %d, '%s', %d, %d)",
+			origin, blockTime.Truncate(time.Hour).Format(Format), 1, msgType, stats[msgType].Count, stats[msgType].FailedCount))
+	}
+	return fmt.Sprintf(addMessageStatsQuery, strings.Join(values, ", "))
+}
+
 func addClients(origin string, clients map[string]string) string {
 	values := ""
 	for clientID, chainID := range clients {
@@ -113,26 +312,260 @@ func markChannel(origin, channelID string, state bool) string {
 		channelID)
 }
 
+func markChannelClosedAt(origin, channelID string, closedAt time.Time) string {
+	return fmt.Sprintf(markChannelClosedAtQuery,
+		closedAt.Format(Format),
+		origin,
+		channelID)
+}
+
+// addClosedChannelIbcStats counts transfers over closed channels, their amounts are kept apart
+// from cashflow as well, so amounts and counts of open channels agree
+func addClosedChannelIbcStats(origin string, ibcData map[string]map[string]map[string]map[time.Time]*processor.IbcCounters) []string {
+	queries := make([]string, 0, 4)
+	var cashflow []string
+	for source, destMap := range ibcData {
+		for dest, channelMap := range destMap {
+			for channel, hourMap := range channelMap {
+				for hour, count := range hourMap {
+					queries = append(queries, fmt.Sprintf(addClosedChannelIbcStatsQuery,
+						fmt.Sprintf("('%s', '%s', '%s', '%s', %d, '%s', %d, %d)", origin, source, dest, hour.Format(Format), 1, channel, count.Transfers, count.FailedTransfers),
+						count.Transfers, count.FailedTransfers))
+					for denom, amount := range count.Coin {
+						cashflow = append(cashflow, fmt.Sprintf("('%s', '%s', '%s', timestamp '%s', %d, '%s', '%s', %d::numeric)", origin, source, dest, hour.Format(Format), 1, channel, denom, amount))
+					}
+				}
+			}
+		}
+	}
+	if len(cashflow) > 0 {
+		sort.Strings(cashflow)
+		queries = append(queries, fmt.Sprintf(addClosedChannelIbcCashflowQuery, strings.Join(cashflow, ", ")))
+	}
+	return queries
+}
+
 func addIbcStats(origin string, ibcData map[string]map[string]map[string]map[time.Time]*processor.IbcCounters) []string {
 	// buffer for our queries
-	queries := make([]string, 0, 32)
+	queries := make([]string, 0, 2)
 
-	// process ibc transfers
+	// process ibc transfers, all rows of the block go to one statement per table
+	var stats, cashflow []string
 	for source, destMap := range ibcData {
 		for dest, hourMap := range destMap {
 			for channel, channelMap := range hourMap {
 				for hour, count := range channelMap {
-					queries = append(queries, fmt.Sprintf(addIbcStatsQuery,
-						fmt.Sprintf("('%s', '%s', '%s', '%s', %d, %d, '%s', %d)", origin, source, dest, hour.Format(Format), count.Transfers, 1, channel, count.FailedTransfers),
-						count.Transfers, count.FailedTransfers))
+					stats = append(stats, fmt.Sprintf("('%s', '%s', '%s', '%s', %d, %d, '%s', %d)", origin, source, dest, hour.Format(Format), count.Transfers, 1, channel, count.FailedTransfers))
 					for denom, amount := range count.Coin {
-						queries = append(queries, fmt.Sprintf(addIbcCashflowQuery,
-							fmt.Sprintf("('%s', '%s', '%s', '%s', %d, '%s', '%s', %d)", origin, source, dest, hour.Format(Format), 1, channel, denom, amount),
-							amount))
+						cashflow = append(cashflow, fmt.Sprintf("('%s', '%s', '%s', timestamp '%s', %d, '%s', '%s', %d::numeric, '%s')", origin, source, dest, hour.Format(Format), 1, channel, denom, amount, processor.BaseDenom(denom)))
+					}
+				}
+			}
+		}
+	}
+	if len(stats) > 0 {
+		queries = append(queries, fmt.Sprintf(addIbcStatsQuery, strings.Join(stats, ", ")))
+	}
+	if len(cashflow) > 0 {
+		queries = append(queries, fmt.Sprintf(addIbcCashflowQuery, strings.Join(cashflow, ", ")))
+	}
+	return queries
+}
+
+func addPendingIbcTransfers(origin string, transfers []processor.PendingIbcTransfer) string {
+	values := ""
+	for _, transfer := range transfers {
+		denoms, amounts := "", ""
+		for _, coin := range transfer.Amount {
+			denoms += fmt.Sprintf("'%s',", coin.Coin)
+			amounts += fmt.Sprintf("%d,", coin.Amount)
+		}
+		if len(denoms) > 0 {
+			denoms, amounts = denoms[:len(denoms)-1], amounts[:len(amounts)-1]
+		}
+		values += fmt.Sprintf("('%s', '%s', '%s', %t, %t, '%s', array[%s]::text[], array[%s]::numeric[]),",
+			origin, transfer.Channel, transfer.Hour.Format(Format), transfer.Source, transfer.Failed, transfer.TxHash, denoms, amounts)
+	}
+	if len(values) > 0 {
+		values = values[:len(values)-1]
+	}
+	return fmt.Sprintf(addPendingIbcTransfersQuery, values)
+}
+
+func resolvePendingIbcTransfers(origin string) string {
+	filter := ""
+	if len(origin) > 0 {
+		filter = fmt.Sprintf(" and p.zone = '%s'", origin)
+	}
+	return fmt.Sprintf(resolvePendingIbcTransfersQuery, filter)
+}
+
+func recalculateChannelSupply(origin, channelID string, from time.Time) string {
+	return fmt.Sprintf(recalculateChannelSupplyQuery, origin, channelID, from.Format(Format))
+}
+
+func addDenomTraces(origin string, traces map[string]processor.DenomTrace) string {
+	values := ""
+	for _, trace := range traces {
+		values += fmt.Sprintf("('%s', '%s', '%s', '%s', '%s'),", origin, trace.IbcDenom, trace.Path, trace.BaseDenom, trace.Origin)
+	}
+	if len(values) > 0 {
+		values = values[:len(values)-1]
+	}
+	return fmt.Sprintf(addDenomTracesQuery, values)
+}
+
+type supplyKey struct {
+	channel string
+	hour    time.Time
+	denom   string
+}
+
+// addChannelSupply updates outstanding supply ledger of the zone from coins sent and received over its channels
+func addChannelSupply(origin string, stats ...processor.IbcData) string {
+	sent := make(map[supplyKey]*big.Int)
+	received := make(map[supplyKey]*big.Int)
+	var keys []supplyKey
+	add := func(flow map[supplyKey]*big.Int, key supplyKey, amount *big.Int) {
+		if _, ok := sent[key]; !ok {
+			sent[key], received[key] = new(big.Int), new(big.Int)
+			keys = append(keys, key)
+		}
+		flow[key].Add(flow[key], amount)
+	}
+
+	for _, ibcData := range stats {
+		for source, destMap := range ibcData {
+			for dest, channelMap := range destMap {
+				for channel, hourMap := range channelMap {
+					for hour, count := range hourMap {
+						for denom, amount := range count.Coin {
+							switch origin {
+							case source:
+								add(sent, supplyKey{channel, hour, denom}, amount)
+							case dest:
+								add(received, supplyKey{channel, hour, processor.UnwoundDenom(denom)}, amount)
+							}
+						}
 					}
 				}
 			}
 		}
 	}
+	if len(keys) == 0 {
+		return ""
+	}
+	// rows are ordered, so concurrent commits lock them in the same order
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].channel != keys[j].channel {
+			return keys[i].channel < keys[j].channel
+		}
+		if !keys[i].hour.Equal(keys[j].hour) {
+			return keys[i].hour.Before(keys[j].hour)
+		}
+		return keys[i].denom < keys[j].denom
+	})
+
+	values := ""
+	for _, key := range keys {
+		values += fmt.Sprintf("('%s', '%s', timestamp '%s', '%s', %d::numeric, %d::numeric),",
+			origin, key.channel, key.hour.Format(Format), key.denom, sent[key], received[key])
+	}
+	return fmt.Sprintf(addChannelSupplyQuery, values[:len(values)-1])
+}
+
+// addTokenPrices upserts prices, the last one wins if price of denom is listed more than once during the hour
+func addTokenPrices(tokenPrices []prices.Price) string {
+	type priceKey struct {
+		denom string
+		hour  time.Time
+	}
+	byKey := make(map[priceKey]float64, len(tokenPrices))
+	keys := make([]priceKey, 0, len(tokenPrices))
+	for _, price := range tokenPrices {
+		key := priceKey{price.Denom, price.Hour.UTC().Truncate(time.Hour)}
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = price.USD
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].denom != keys[j].denom {
+			return keys[i].denom < keys[j].denom
+		}
+		return keys[i].hour.Before(keys[j].hour)
+	})
+
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, fmt.Sprintf("('%s', timestamp '%s', %s::numeric)",
+			escape(key.denom), key.hour.Format(Format), strconv.FormatFloat(byKey[key], 'f', -1, 64)))
+	}
+	return fmt.Sprintf(addTokenPricesQuery, strings.Join(values, ", "))
+}
+
+func changedPrices(since time.Time) string {
+	return fmt.Sprintf(changedPricesQuery, since.Format(PreciseFormat))
+}
+
+func repriceStats(from, to time.Time) []string {
+	queries := []string{
+		repriceTurnoverQuery,
+		repriceIbcCashflowQuery,
+		queueRepricedHoursQuery,
+	}
+	for i, query := range queries {
+		queries[i] = fmt.Sprintf(query, from.Format(Format), to.Format(Format))
+	}
 	return queries
 }
+
+func markRollupHour(chainID string, hour time.Time) string {
+	return fmt.Sprintf(markRollupHourQuery, chainID, hour.Truncate(time.Hour).Format(Format))
+}
+
+// rollupTables are stats tables which rollupStats recalculates, in the order of their queries,
+// sketches are merged in go by rollupAddressSketches
+var rollupTables = []string{
+	"total_tx_hourly_stats",
+	"total_coin_turnover_hourly_stats",
+	"active_addresses",
+	"message_types_hourly_stats",
+	"block_hourly_stats",
+	"ibc_transfer_hourly_stats",
+	"ibc_transfer_hourly_cashflow",
+}
+
+func rollupStats(chainID string, period Period, start time.Time) []string {
+	rollups := []string{
+		rollupTxStatsQuery,
+		rollupTxTurnoverQuery,
+		rollupActiveAddressesQuery,
+		rollupMessageStatsQuery,
+		rollupBlockStatsQuery,
+		rollupIbcStatsQuery,
+		rollupIbcCashflowQuery,
+	}
+	queries := make([]string, 0, 2*len(rollups))
+	for i, query := range rollups {
+		args := []interface{}{chainID, start.Format(Format), period.End(start).Format(Format), period, rollupTables[i]}
+		queries = append(queries, fmt.Sprintf(deleteRollupStatsQuery, args...), fmt.Sprintf(query, args[:4]...))
+	}
+	return queries
+}
+
+// rollupAddressSketches replaces sketches of the period by the ones merged from its hourly sketches
+func rollupAddressSketches(chainID string, period Period, start time.Time, sketches map[string]*hll.Sketch) []string {
+	queries := []string{fmt.Sprintf(deleteRollupStatsQuery, chainID, start.Format(Format), period.End(start).Format(Format), period, "active_addresses_hll")}
+	if len(sketches) > 0 {
+		queries = append(queries, addAddressSketches(chainID, start, period, sketches))
+	}
+	return queries
+}
+
+func deferRollupPeriod(chainID string, period Period, start time.Time) string {
+	return fmt.Sprintf(deferRollupPeriodQuery, chainID, start.Format(Format), period)
+}
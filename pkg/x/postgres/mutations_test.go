@@ -1,13 +1,27 @@
 package postgres
 
 import (
-	processor "github.com/mapofzones/txs-processor/pkg/types"
-	"github.com/stretchr/testify/assert"
+	"context"
+	"fmt"
 	"math/big"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/jackc/pgx/v4"
+	watcher "github.com/mapofzones/cosmos-watcher/pkg/types"
+	"github.com/mapofzones/txs-processor/pkg/hll"
+	"github.com/mapofzones/txs-processor/pkg/prices"
+	"github.com/mapofzones/txs-processor/pkg/registry"
+	processor "github.com/mapofzones/txs-processor/pkg/types"
+	"github.com/stretchr/testify/assert"
 )
 
+// noChains is a registry which knows no chains
+func noChains(string) (registry.Chain, bool) {
+	return registry.Chain{}, false
+}
+
 func Test_addZone(t *testing.T) {
 	type args struct {
 		chainID string
@@ -17,18 +31,76 @@ func Test_addZone(t *testing.T) {
 		args     args
 		expected string
 	}{
-		{"empty_args", args{}, "insert into zones(name, chain_id, is_enabled, is_caught_up) values ('', '', true, false)\n    on conflict (chain_id) do update\n        set is_enabled = true;"},
-		{"first_args", args{"myChain1"}, "insert into zones(name, chain_id, is_enabled, is_caught_up) values ('myChain1', 'myChain1', true, false)\n    on conflict (chain_id) do update\n        set is_enabled = true;"},
-		{"second_args", args{"myChain2"}, "insert into zones(name, chain_id, is_enabled, is_caught_up) values ('myChain2', 'myChain2', true, false)\n    on conflict (chain_id) do update\n        set is_enabled = true;"},
+		{"empty_args", args{}, "insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values ('', '', true, false, null, null, null)\n    on conflict (chain_id) do update\n        set is_enabled = true;"},
+		{"first_args", args{"myChain1"}, "insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values ('myChain1', 'myChain1', true, false, null, null, null)\n    on conflict (chain_id) do update\n        set is_enabled = true;"},
+		{"second_args", args{"myChain2"}, "insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values ('myChain2', 'myChain2', true, false, null, null, null)\n    on conflict (chain_id) do update\n        set is_enabled = true;"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := addZone(tt.args.chainID)
+			actual := addZone(tt.args.chainID, noChains)
 			assert.Equal(t, tt.expected, actual)
 		})
 	}
 }
 
+func Test_addZoneWithMetadata(t *testing.T) {
+	lookup := func(chainID string) (registry.Chain, bool) {
+		return registry.Chain{
+			ChainID:      chainID,
+			PrettyName:   "Cosmos' Hub",
+			Bech32Prefix: "cosmos",
+			LogoURL:      "https://example.com/atom.png",
+			Assets:       []registry.Asset{{Base: "uatom", Display: "atom", Symbol: "ATOM", Decimals: 6}},
+		}, chainID == "cosmoshub-4"
+	}
+	assert.Equal(t, "insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values "+
+		"('Cosmos'' Hub', 'cosmoshub-4', true, false, 'cosmos', 'https://example.com/atom.png', '[{\"denom\":\"uatom\",\"symbol\":\"ATOM\",\"decimals\":6}]'::jsonb)\n"+
+		"    on conflict (chain_id) do update\n        set is_enabled = true;", addZone("cosmoshub-4", lookup))
+	assert.Equal(t, "insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values "+
+		"('Cosmos'' Hub', 'cosmoshub-4', false, false, 'cosmos', 'https://example.com/atom.png', '[{\"denom\":\"uatom\",\"symbol\":\"ATOM\",\"decimals\":6}]'::jsonb),"+
+		"('unknown-1', 'unknown-1', false, false, null, null, null)\n"+
+		"    on conflict (chain_id) do nothing;", addImplicitZones(map[string]string{"07-tendermint-1": "unknown-1", "07-tendermint-0": "cosmoshub-4"}, lookup))
+}
+
+func Test_updateZonesMetadata(t *testing.T) {
+	assert.Equal(t, []string{"update zones\n    set name = chain_id,\n        bech32_prefix = null,\n        logo_url = null,\n        native_denoms = null\n" +
+		"        where chain_id <> all(array[]::text[])\n" +
+		"            and (name, bech32_prefix, logo_url, native_denoms) is distinct from (chain_id, null, null, null);"}, updateZonesMetadata(nil))
+
+	chains := []registry.Chain{
+		{ChainID: "osmosis-1", ChainName: "osmosis"},
+		{
+			ChainID:      "cosmoshub-4",
+			PrettyName:   "Cosmos' Hub",
+			Bech32Prefix: "cosmos",
+			LogoURL:      "https://example.com/atom.png",
+			Assets:       []registry.Asset{{Base: "uatom", Display: "atom", Symbol: "ATOM", Decimals: 6}},
+		},
+	}
+	assert.Equal(t, []string{
+		"update zones\n    set name = chain_id,\n        bech32_prefix = null,\n        logo_url = null,\n        native_denoms = null\n" +
+			"        where chain_id <> all(array['cosmoshub-4','osmosis-1']::text[])\n" +
+			"            and (name, bech32_prefix, logo_url, native_denoms) is distinct from (chain_id, null, null, null);",
+		"update zones\n    set name = m.name,\n        bech32_prefix = m.bech32_prefix,\n        logo_url = m.logo_url,\n        native_denoms = m.native_denoms::jsonb\n" +
+			"    from (values ('cosmoshub-4', 'Cosmos'' Hub', 'cosmos', 'https://example.com/atom.png', '[{\"denom\":\"uatom\",\"symbol\":\"ATOM\",\"decimals\":6}]'), ('osmosis-1', 'osmosis', '', '', '[]')) as m(chain_id, name, bech32_prefix, logo_url, native_denoms)\n" +
+			"        where zones.chain_id = m.chain_id\n" +
+			"            and (zones.name, zones.bech32_prefix, zones.logo_url, zones.native_denoms)\n" +
+			"                is distinct from (m.name, m.bech32_prefix, m.logo_url, m.native_denoms::jsonb);",
+	}, updateZonesMetadata(chains))
+}
+
+func Test_addDenomMetadata(t *testing.T) {
+	assert.Equal(t, "", addDenomMetadata(nil))
+
+	denoms := []registry.Denom{
+		{Denom: "uatom", Display: "atom", Exponent: 6},
+		{Denom: "aevmos", Display: "evmos", Exponent: 18},
+		{Denom: "uatom", Display: "ATOM", Exponent: 6},
+	}
+	assert.Equal(t, "insert into denom_metadata(denom, display, exponent) values ('aevmos', 'evmos', 18), ('uatom', 'ATOM', 6)\n"+
+		"    on conflict (denom) do update\n        set display = EXCLUDED.display,\n            exponent = EXCLUDED.exponent;", addDenomMetadata(denoms))
+}
+
 func Test_addImplicitZones(t *testing.T) {
 	type args struct {
 		clients map[string]string
@@ -39,12 +111,12 @@ func Test_addImplicitZones(t *testing.T) {
 		expected string
 	}{
 		{"empty_args", args{}, ""},
-		{"first_pair", args{map[string]string{"clientId1": "chainId1"}}, "insert into zones(name, chain_id, is_enabled, is_caught_up) values ('chainId1', 'chainId1', false, false)\n    on conflict (chain_id) do nothing;"},
-		{"second_pair", args{map[string]string{"clientId2": "chainId2"}}, "insert into zones(name, chain_id, is_enabled, is_caught_up) values ('chainId2', 'chainId2', false, false)\n    on conflict (chain_id) do nothing;"},
+		{"first_pair", args{map[string]string{"clientId1": "chainId1"}}, "insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values ('chainId1', 'chainId1', false, false, null, null, null)\n    on conflict (chain_id) do nothing;"},
+		{"second_pair", args{map[string]string{"clientId2": "chainId2"}}, "insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values ('chainId2', 'chainId2', false, false, null, null, null)\n    on conflict (chain_id) do nothing;"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := addImplicitZones(tt.args.clients)
+			actual := addImplicitZones(tt.args.clients, noChains)
 			assert.Equal(t, tt.expected, actual)
 		})
 	}
@@ -52,26 +124,87 @@ func Test_addImplicitZones(t *testing.T) {
 
 func Test_markBlockConstruct(t *testing.T) {
 	type args struct {
-		chainID string
-		time    string
+		chainID   string
+		time      string
+		blockTime string
 	}
 	tests := []struct {
 		name     string
 		args     args
 		expected string
 	}{
-		{"empty_args", args{}, "insert into blocks_log(zone, last_processed_block, last_updated_at) values ('', 1, '')\n    on conflict (zone) do update\n        set last_processed_block = blocks_log.last_processed_block + 1,\n            last_updated_at = '';"},
-		{"first_args", args{"chainID1", "2006-01-02T15:04:05"}, "insert into blocks_log(zone, last_processed_block, last_updated_at) values ('chainID1', 1, '2006-01-02T15:04:05')\n    on conflict (zone) do update\n        set last_processed_block = blocks_log.last_processed_block + 1,\n            last_updated_at = '2006-01-02T15:04:05';"},
-		{"second_args", args{"chainID2", "2016-12-02T06:14:55"}, "insert into blocks_log(zone, last_processed_block, last_updated_at) values ('chainID2', 1, '2016-12-02T06:14:55')\n    on conflict (zone) do update\n        set last_processed_block = blocks_log.last_processed_block + 1,\n            last_updated_at = '2016-12-02T06:14:55';"},
+		{"empty_args", args{}, "insert into blocks_log(zone, last_processed_block, last_updated_at, last_block_time) values ('', 1, '', '')\n    on conflict (zone) do update\n        set last_processed_block = blocks_log.last_processed_block + 1,\n            last_updated_at = '',\n            last_block_time = '';"},
+		{"first_args", args{"chainID1", "2006-01-02T15:04:05", "2006-01-02T15:03:58.5"}, "insert into blocks_log(zone, last_processed_block, last_updated_at, last_block_time) values ('chainID1', 1, '2006-01-02T15:04:05', '2006-01-02T15:03:58.5')\n    on conflict (zone) do update\n        set last_processed_block = blocks_log.last_processed_block + 1,\n            last_updated_at = '2006-01-02T15:04:05',\n            last_block_time = '2006-01-02T15:03:58.5';"},
+		{"second_args", args{"chainID2", "2016-12-02T06:14:55", "2016-12-01T22:00:01"}, "insert into blocks_log(zone, last_processed_block, last_updated_at, last_block_time) values ('chainID2', 1, '2016-12-02T06:14:55', '2016-12-01T22:00:01')\n    on conflict (zone) do update\n        set last_processed_block = blocks_log.last_processed_block + 1,\n            last_updated_at = '2016-12-02T06:14:55',\n            last_block_time = '2016-12-01T22:00:01';"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := markBlockConstruct(tt.args.chainID, tt.args.time)
+			actual := markBlockConstruct(tt.args.chainID, tt.args.time, tt.args.blockTime)
 			assert.Equal(t, tt.expected, actual)
 		})
 	}
 }
 
+func Test_markBlock(t *testing.T) {
+	now := time.Date(2021, 7, 1, 10, 16, 0, 0, time.UTC)
+	blockTime := time.Date(2021, 7, 1, 12, 15, 30, 250000000, time.FixedZone("CEST", 2*60*60))
+	assert.Equal(t, markBlockConstruct("myChainID", "2021-07-01T10:16:00", "2021-07-01T10:15:30.25"), markBlock("myChainID", now, blockTime))
+}
+
+func Test_resyncBlock(t *testing.T) {
+	assert.Equal(t, "update blocks_log\n    set last_processed_block = 41\n        where zone = 'myChainID' and last_processed_block < 41;", resyncBlock("myChainID", 41))
+}
+
+func Test_markCaughtUp(t *testing.T) {
+	assert.Equal(t, "update zones\n    set is_caught_up = true\n        where chain_id = 'myChainID' and is_caught_up is distinct from true;", markCaughtUp("myChainID", true))
+	assert.Equal(t, "update zones\n    set is_caught_up = false\n        where chain_id = 'myChainID' and is_caught_up is distinct from false;", markCaughtUp("myChainID", false))
+}
+
+func Test_markStaleZones(t *testing.T) {
+	cutoff := time.Date(2021, 7, 1, 10, 30, 0, 500000000, time.UTC)
+	assert.Equal(t, "update zones\n    set is_caught_up = false\n        from blocks_log b\n        where b.zone = zones.chain_id and b.last_block_time < '2021-07-01T10:30:00.5' and zones.is_caught_up is distinct from false;", markStaleZones(cutoff))
+}
+
+func Test_addBlockStats(t *testing.T) {
+	blockTime := time.Date(2021, 7, 1, 10, 15, 30, 250000000, time.UTC)
+	suffix := "\n    on conflict (zone, height) do nothing\n    returning zone, time, txs_cnt, msgs_cnt, interval_ms)\n" +
+		"insert into block_hourly_stats(zone, hour, period, blocks_cnt, empty_blocks_cnt, txs_cnt, msgs_cnt, intervals_cnt, interval_sum_ms, interval_max_ms)\n" +
+		"    select zone, date_trunc('hour', time), 1, 1, (txs_cnt = 0)::int, txs_cnt, msgs_cnt, (interval_ms is not null)::int, coalesce(interval_ms, 0), interval_ms from block\n" +
+		"    on conflict (zone, hour, period) do update\n        set blocks_cnt = block_hourly_stats.blocks_cnt + EXCLUDED.blocks_cnt,\n" +
+		"            empty_blocks_cnt = block_hourly_stats.empty_blocks_cnt + EXCLUDED.empty_blocks_cnt,\n" +
+		"            txs_cnt = block_hourly_stats.txs_cnt + EXCLUDED.txs_cnt,\n            msgs_cnt = block_hourly_stats.msgs_cnt + EXCLUDED.msgs_cnt,\n" +
+		"            intervals_cnt = block_hourly_stats.intervals_cnt + EXCLUDED.intervals_cnt,\n" +
+		"            interval_sum_ms = block_hourly_stats.interval_sum_ms + EXCLUDED.interval_sum_ms,\n" +
+		"            interval_max_ms = greatest(block_hourly_stats.interval_max_ms, EXCLUDED.interval_max_ms);"
+	tests := []struct {
+		name     string
+		block    watcher.Block
+		expected string
+	}{
+		{
+			"empty_block",
+			watcher.Block{ChainID_: "myChainID", Height_: 10, T: blockTime},
+			"with block as (\n    insert into block_stats(zone, height, time, txs_cnt, msgs_cnt, interval_ms)\n        select 'myChainID', 10, timestamp '2021-07-01T10:15:30.25', 0, 0,\n" +
+				"            (select (extract(epoch from timestamp '2021-07-01T10:15:30.25' - b.time) * 1000)::bigint from block_stats b\n                where b.zone = 'myChainID' and b.height = 10 - 1)" + suffix,
+		},
+		{
+			"txs_and_messages",
+			watcher.Block{ChainID_: "myChainID", Height_: 11, T: blockTime, Msgs: []watcher.Message{
+				watcher.Transaction{Messages: []watcher.Message{watcher.Transfer{}, watcher.IBCTransfer{}}},
+				watcher.Transaction{Messages: []watcher.Message{watcher.Transfer{}}},
+				watcher.CreateClient{},
+			}},
+			"with block as (\n    insert into block_stats(zone, height, time, txs_cnt, msgs_cnt, interval_ms)\n        select 'myChainID', 11, timestamp '2021-07-01T10:15:30.25', 2, 4,\n" +
+				"            (select (extract(epoch from timestamp '2021-07-01T10:15:30.25' - b.time) * 1000)::bigint from block_stats b\n                where b.zone = 'myChainID' and b.height = 11 - 1)" + suffix,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, addBlockStats(tt.block))
+		})
+	}
+}
+
 func Test_addTxStats(t *testing.T) {
 	type args struct {
 		stats processor.TxStats
@@ -105,12 +238,133 @@ func Test_addTxStats(t *testing.T) {
 	}
 }
 
+func Test_addTxTurnover(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	type args struct {
+		stats processor.TxStats
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+	}{
+		{"empty_args", args{}, ""},
+		{
+			"first_args",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, Turnover: map[string]*big.Int{"uatom": big.NewInt(11111122222333333)}}},
+			"insert into total_coin_turnover_hourly_stats(zone, hour, period, denom, amount, amount_display, amount_usd)\n    select v.zone, v.hour, v.period, v.denom, v.amount, v.amount / power(10::numeric, m.exponent), v.amount / power(10::numeric, m.exponent) * p.price_usd\n    from (values ('myChainID', timestamp '2006-01-02T15:00:00', 1, 'uatom', 11111122222333333::numeric, 'uatom')) as v(zone, hour, period, denom, amount, base_denom)\n        left join denom_traces t on t.zone = v.zone and t.ibc_denom = v.denom\n        left join denom_metadata m on m.denom = coalesce(t.base_denom, v.base_denom)\n        left join token_prices p on p.denom = m.denom and p.hour = v.hour\n    on conflict (zone, hour, period, denom) do update\n        set amount = total_coin_turnover_hourly_stats.amount + EXCLUDED.amount,\n            amount_display = coalesce((total_coin_turnover_hourly_stats.amount + EXCLUDED.amount) * EXCLUDED.amount_display / nullif(EXCLUDED.amount, 0),\n                total_coin_turnover_hourly_stats.amount_display),\n            amount_usd = coalesce((total_coin_turnover_hourly_stats.amount + EXCLUDED.amount) * EXCLUDED.amount_usd / nullif(EXCLUDED.amount, 0),\n                total_coin_turnover_hourly_stats.amount_usd);",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addTxTurnover(tt.args.stats)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_addNewAddresses(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	type args struct {
+		stats processor.TxStats
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+	}{
+		{"no_addresses", args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs}}, ""},
+		{
+			"addresses",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, Addresses: []*processor.AddressData{{Address: "cosmos1sender", IsInternalTx: true}, {Address: "cosmos1recipient", IsInternalReceive: true}}}},
+			"with new_addresses as (\n    insert into address_first_seen(zone, address, hour)\n        select 'myChainID', address, '2006-01-02T15:00:00' from unnest(array['cosmos1sender','cosmos1recipient']::text[]) as t(address)\n    on conflict (zone, address) do nothing\n    returning address)\nupdate total_tx_hourly_stats\n    set new_addresses_cnt = new_addresses_cnt + (select count(*) from new_addresses)\n        where zone = 'myChainID' and hour = '2006-01-02T15:00:00' and period = 1;",
+		},
+		{
+			"counterparty_sender",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, Addresses: []*processor.AddressData{{Address: "osmo1sender", IsExternalTransfer: true}, {Address: "cosmos1recipient", IsExternalReceive: true}}}},
+			"with new_addresses as (\n    insert into address_first_seen(zone, address, hour)\n        select 'myChainID', address, '2006-01-02T15:00:00' from unnest(array['cosmos1recipient']::text[]) as t(address)\n    on conflict (zone, address) do nothing\n    returning address)\nupdate total_tx_hourly_stats\n    set new_addresses_cnt = new_addresses_cnt + (select count(*) from new_addresses)\n        where zone = 'myChainID' and hour = '2006-01-02T15:00:00' and period = 1;",
+		},
+		{"only_counterparty_sender", args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, Addresses: []*processor.AddressData{{Address: "osmo1sender", IsExternalTransfer: true}}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addNewAddresses(tt.args.stats)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_addAddressSketches(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	assert.Equal(t, "", addAddressSketches("myChainID", timeArgs, Hour, nil))
+
+	sketches := addressSketches([]*processor.AddressData{
+		{Address: "cosmos1sender", IsInternalTx: true, IsExternalTransfer: true},
+		{Address: "cosmos1recipient", IsInternalReceive: true},
+	})
+	sketch := func(addresses ...string) string {
+		s := hll.New()
+		for _, address := range addresses {
+			s.AddString(address)
+		}
+		return fmt.Sprintf("'\\x%x'", s.Bytes())
+	}
+	expected := fmt.Sprintf("insert into active_addresses_hll(zone, hour, period, role, sketch) values "+
+		"('myChainID', '2006-01-02T15:00:00', 1, 'all', %s), "+
+		"('myChainID', '2006-01-02T15:00:00', 1, 'external_transfer', %s), "+
+		"('myChainID', '2006-01-02T15:00:00', 1, 'internal_receive', %s), "+
+		"('myChainID', '2006-01-02T15:00:00', 1, 'internal_tx', %s)\n"+
+		"    on conflict (zone, hour, period, role) do update\n"+
+		"        set sketch = EXCLUDED.sketch;",
+		sketch("cosmos1sender", "cosmos1recipient"), sketch("cosmos1sender"), sketch("cosmos1recipient"), sketch("cosmos1sender"))
+	assert.Equal(t, expected, addAddressSketches("myChainID", timeArgs, Hour, sketches))
+}
+
+func Test_rollupAddressSketches(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2021-07-01T00:00:00")
+	deleted := "delete from active_addresses_hll\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';"
+	assert.Equal(t, []string{deleted}, rollupAddressSketches("myChainID", Month, timeArgs, nil))
+
+	sketches := map[string]*hll.Sketch{RoleAll: hll.New()}
+	assert.Equal(t, []string{deleted, addAddressSketches("myChainID", timeArgs, Month, sketches)},
+		rollupAddressSketches("myChainID", Month, timeArgs, sketches))
+}
+
+func Test_addInvalidAddresses(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	type args struct {
+		stats processor.TxStats
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+	}{
+		{"empty_args", args{}, ""},
+		{
+			"empty_sender",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, InvalidAddresses: map[processor.InvalidAddress]int{{Address: "", Reason: processor.InvalidAddressEmpty}: 3}}},
+			"insert into invalid_addresses_hourly_stats(zone, hour, address, reason, cnt) values ('myChainID', '2006-01-02T15:00:00', '', 'empty', 3)\n    on conflict (zone, hour, address, reason) do update\n        set cnt = invalid_addresses_hourly_stats.cnt + EXCLUDED.cnt;",
+		},
+		{
+			"escaped_address",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, InvalidAddresses: map[processor.InvalidAddress]int{{Address: "moz'; drop table zones;", Reason: processor.InvalidAddressBech32}: 1}}},
+			"insert into invalid_addresses_hourly_stats(zone, hour, address, reason, cnt) values ('myChainID', '2006-01-02T15:00:00', 'moz''; drop table zones;', 'invalid_bech32', 1)\n    on conflict (zone, hour, address, reason) do update\n        set cnt = invalid_addresses_hourly_stats.cnt + EXCLUDED.cnt;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addInvalidAddresses(tt.args.stats)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
 func Test_addActiveAddressesStats(t *testing.T) {
 	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:04:05")
 	timeArgs2, _ := time.Parse("2006-01-02T15:04:05", "2018-13-11T09:17:22")
 	type args struct {
-		stats   processor.TxStats
-		address *processor.AddressData
+		stats processor.TxStats
 	}
 	tests := []struct {
 		name     string
@@ -118,34 +372,60 @@ func Test_addActiveAddressesStats(t *testing.T) {
 		expected string
 	}{
 		{
-			"first_empty_args",
-			args{address: &processor.AddressData{}},
-			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer) values ('', '', '0001-01-01T00:00:00', 1, false, false, false)\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer;",
+			"no_addresses",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs}},
+			"",
 		},
 		{
-			"second_empty_args",
-			args{processor.TxStats{}, &processor.AddressData{Address: "", IsInternalTx: true, IsInternalTransfer: false, IsExternalTransfer: false}},
-			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer) values ('', '', '0001-01-01T00:00:00', 1, true, false, false)\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer;",
+			"first_empty_args",
+			args{processor.TxStats{Addresses: []*processor.AddressData{{}}}},
+			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n    select address, '', '0001-01-01T00:00:00', 1, bool_or(is_internal_tx), bool_or(is_internal_transfer), bool_or(is_external_transfer), bool_or(is_internal_receive), bool_or(is_external_receive),\n            (array_agg(address_payload) filter (where address_payload is not null))[1]\n        from unnest(array['']::text[], array[false]::boolean[], array[false]::boolean[], array[false]::boolean[], array[false]::boolean[], array[false]::boolean[], array[null]::bytea[])\n            as t(address, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n        group by address\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer,\n\t\t\tis_internal_receive = active_addresses.is_internal_receive or EXCLUDED.is_internal_receive,\n\t\t\tis_external_receive = active_addresses.is_external_receive or EXCLUDED.is_external_receive,\n\t\t\taddress_payload = coalesce(active_addresses.address_payload, EXCLUDED.address_payload);",
 		},
 		{
 			"first_args",
-			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs}, &processor.AddressData{Address: "moz:kfdjf928hfjvnczmnvsohvyuqoefiudb", IsInternalTx: true, IsInternalTransfer: false, IsExternalTransfer: false}},
-			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer) values ('moz:kfdjf928hfjvnczmnvsohvyuqoefiudb', 'myChainID', '2006-01-02T15:04:05', 1, true, false, false)\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer;",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, Addresses: []*processor.AddressData{{Address: "moz:kfdjf928hfjvnczmnvsohvyuqoefiudb", IsInternalTx: true, IsInternalTransfer: false, IsExternalTransfer: false}}}},
+			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n    select address, 'myChainID', '2006-01-02T15:04:05', 1, bool_or(is_internal_tx), bool_or(is_internal_transfer), bool_or(is_external_transfer), bool_or(is_internal_receive), bool_or(is_external_receive),\n            (array_agg(address_payload) filter (where address_payload is not null))[1]\n        from unnest(array['moz:kfdjf928hfjvnczmnvsohvyuqoefiudb']::text[], array[true]::boolean[], array[false]::boolean[], array[false]::boolean[], array[false]::boolean[], array[false]::boolean[], array[null]::bytea[])\n            as t(address, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n        group by address\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer,\n\t\t\tis_internal_receive = active_addresses.is_internal_receive or EXCLUDED.is_internal_receive,\n\t\t\tis_external_receive = active_addresses.is_external_receive or EXCLUDED.is_external_receive,\n\t\t\taddress_payload = coalesce(active_addresses.address_payload, EXCLUDED.address_payload);",
 		},
 		{
 			"second_args",
-			args{processor.TxStats{ChainID: "myChainID2", Hour: timeArgs2}, &processor.AddressData{Address: "moz:df89hrui3kjdf8iydhgayud", IsInternalTx: true, IsInternalTransfer: false, IsExternalTransfer: false}},
-			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer) values ('moz:df89hrui3kjdf8iydhgayud', 'myChainID2', '0001-01-01T00:00:00', 1, true, false, false)\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer;",
+			args{processor.TxStats{ChainID: "myChainID2", Hour: timeArgs2, Addresses: []*processor.AddressData{
+				{Address: "moz:df89hrui3kjdf8iydhgayud", IsInternalTx: true, IsInternalTransfer: false, IsExternalTransfer: false},
+				{Address: "moz:kfdjf928hfjvnczmnvsohvyuqoefiudb", IsInternalTx: false, IsInternalTransfer: false, IsExternalTransfer: true},
+				{Address: "moz:df89hrui3kjdf8iydhgayud", IsInternalTx: false, IsInternalTransfer: true, IsExternalTransfer: false},
+				{Address: "moz:recipient", IsInternalReceive: true, IsExternalReceive: true},
+			}}},
+			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n    select address, 'myChainID2', '0001-01-01T00:00:00', 1, bool_or(is_internal_tx), bool_or(is_internal_transfer), bool_or(is_external_transfer), bool_or(is_internal_receive), bool_or(is_external_receive),\n            (array_agg(address_payload) filter (where address_payload is not null))[1]\n        from unnest(array['moz:df89hrui3kjdf8iydhgayud','moz:kfdjf928hfjvnczmnvsohvyuqoefiudb','moz:df89hrui3kjdf8iydhgayud','moz:recipient']::text[], array[true,false,false,false]::boolean[], array[false,false,true,false]::boolean[], array[false,true,false,false]::boolean[], array[false,false,false,true]::boolean[], array[false,false,false,true]::boolean[], array[null,null,null,null]::bytea[])\n            as t(address, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n        group by address\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer,\n\t\t\tis_internal_receive = active_addresses.is_internal_receive or EXCLUDED.is_internal_receive,\n\t\t\tis_external_receive = active_addresses.is_external_receive or EXCLUDED.is_external_receive,\n\t\t\taddress_payload = coalesce(active_addresses.address_payload, EXCLUDED.address_payload);",
+		},
+		{
+			"decoded_args",
+			args{processor.TxStats{ChainID: "myChainID", Hour: timeArgs, Addresses: []*processor.AddressData{
+				{Address: "cosmos1decoded", IsInternalTx: true, Payload: []byte{0x9b, 0x3c, 0x2f}},
+				{Address: "moz:undecoded", IsInternalReceive: true},
+			}}},
+			"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n    select address, 'myChainID', '2006-01-02T15:04:05', 1, bool_or(is_internal_tx), bool_or(is_internal_transfer), bool_or(is_external_transfer), bool_or(is_internal_receive), bool_or(is_external_receive),\n            (array_agg(address_payload) filter (where address_payload is not null))[1]\n        from unnest(array['cosmos1decoded','moz:undecoded']::text[], array[true,false]::boolean[], array[false,false]::boolean[], array[false,false]::boolean[], array[false,true]::boolean[], array[false,false]::boolean[], array['\\x9b3c2f',null]::bytea[])\n            as t(address, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n        group by address\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,\n\t\t\tis_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,\n\t\t\tis_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer,\n\t\t\tis_internal_receive = active_addresses.is_internal_receive or EXCLUDED.is_internal_receive,\n\t\t\tis_external_receive = active_addresses.is_external_receive or EXCLUDED.is_external_receive,\n\t\t\taddress_payload = coalesce(active_addresses.address_payload, EXCLUDED.address_payload);",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := addActiveAddressesStats(tt.args.stats, *tt.args.address)
+			actual := addActiveAddressesStats(tt.args.stats)
 			assert.Equal(t, tt.expected, actual)
 		})
 	}
 }
 
+func Test_addMessageStats(t *testing.T) {
+	blockTime, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:04:05")
+	assert.Equal(t, "", addMessageStats("myChainID", blockTime, nil))
+
+	stats := processor.MessageStats{
+		"Transaction": {Count: 3, FailedCount: 1},
+		"IBCTransfer": {Count: 2, FailedCount: 1},
+	}
+	assert.Equal(t, "insert into message_types_hourly_stats(zone, hour, period, msg_type, msgs_cnt, msgs_fail_cnt) values ('myChainID', '2006-01-02T15:00:00', 1, 'IBCTransfer', 2, 1), ('myChainID', '2006-01-02T15:00:00', 1, 'Transaction', 3, 1)\n"+
+		"    on conflict (zone, hour, period, msg_type) do update\n        set msgs_cnt = message_types_hourly_stats.msgs_cnt + EXCLUDED.msgs_cnt,\n            msgs_fail_cnt = message_types_hourly_stats.msgs_fail_cnt + EXCLUDED.msgs_fail_cnt;",
+		addMessageStats("myChainID", blockTime, stats))
+}
+
 func Test_addClients(t *testing.T) {
 	type args struct {
 		origin  string
@@ -283,6 +563,52 @@ func Test_markChannel(t *testing.T) {
 	}
 }
 
+func Test_markChannelClosedAt(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:04:05")
+	actual := markChannelClosedAt("origin1", "myChannelID1", timeArgs)
+	assert.Equal(t, "update ibc_channels\n    set closed_at = '2006-01-02T15:04:05'\n        where zone = 'origin1'\n        and channel_id = 'myChannelID1'\n        and closed_at is null;", actual)
+}
+
+func Test_addClosedChannelIbcStats(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	type args struct {
+		origin  string
+		ibcData map[string]map[string]map[string]map[time.Time]*processor.IbcCounters
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected []string
+	}{
+		{"empty_args", args{}, []string{}},
+		{
+			"first_args",
+			args{"origin1", map[string]map[string]map[string]map[time.Time]*processor.IbcCounters{"origin1": {"destZone1": {"channel1": {timeArgs: &processor.IbcCounters{
+				Transfers:       3,
+				FailedTransfers: 3,
+			}}}}}},
+			[]string{"insert into ibc_transfer_hourly_closed_channel_stats(zone, zone_src, zone_dest, hour, period, ibc_channel, txs_cnt, txs_fail_cnt) values ('origin1', 'origin1', 'destZone1', '2006-01-02T15:00:00', 1, 'channel1', 3, 3)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_closed_channel_stats.txs_cnt + 3,\n            txs_fail_cnt = ibc_transfer_hourly_closed_channel_stats.txs_fail_cnt + 3;"},
+		},
+		{
+			"with_amounts",
+			args{"origin1", map[string]map[string]map[string]map[time.Time]*processor.IbcCounters{"origin1": {"destZone1": {"channel1": {timeArgs: &processor.IbcCounters{
+				Transfers: 2,
+				Coin:      map[string]*big.Int{"uatom": big.NewInt(700)},
+			}}}}}},
+			[]string{
+				"insert into ibc_transfer_hourly_closed_channel_stats(zone, zone_src, zone_dest, hour, period, ibc_channel, txs_cnt, txs_fail_cnt) values ('origin1', 'origin1', 'destZone1', '2006-01-02T15:00:00', 1, 'channel1', 2, 0)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_closed_channel_stats.txs_cnt + 2,\n            txs_fail_cnt = ibc_transfer_hourly_closed_channel_stats.txs_fail_cnt + 0;",
+				"insert into ibc_transfer_hourly_closed_channel_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount) values ('origin1', 'origin1', 'destZone1', timestamp '2006-01-02T15:00:00', 1, 'channel1', 'uatom', 700::numeric)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update\n        set amount = ibc_transfer_hourly_closed_channel_cashflow.amount + EXCLUDED.amount;",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addClosedChannelIbcStats(tt.args.origin, tt.args.ibcData)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
 func Test_addIbcStats(t *testing.T) {
 	timeArgs1, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:04:05")
 	timeArgs2, _ := time.Parse("2006-01-02T15:04:05", "2017-09-11T04:20:49")
@@ -313,7 +639,7 @@ func Test_addIbcStats(t *testing.T) {
 				Transfers:       47,
 				FailedTransfers: 8,
 			}}}}}},
-			[]string{"insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values ('origin1', 'sourceZone1', 'destZone1', '2006-01-02T15:04:05', 47, 1, 'channel1', 8)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + 47,\n            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + 8;"},
+			[]string{"insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values ('origin1', 'sourceZone1', 'destZone1', '2006-01-02T15:04:05', 47, 1, 'channel1', 8)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + EXCLUDED.txs_cnt,\n            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + EXCLUDED.txs_fail_cnt;"},
 		},
 		{
 			"second_args",
@@ -321,7 +647,7 @@ func Test_addIbcStats(t *testing.T) {
 				Transfers:       19,
 				FailedTransfers: 3,
 			}}}}}},
-			[]string{"insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values ('origin2', 'sourceZone2', 'destZone2', '2017-09-11T04:20:49', 19, 1, 'channel2', 3)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + 19,\n            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + 3;"},
+			[]string{"insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values ('origin2', 'sourceZone2', 'destZone2', '2017-09-11T04:20:49', 19, 1, 'channel2', 3)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + EXCLUDED.txs_cnt,\n            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + EXCLUDED.txs_fail_cnt;"},
 		},
 		{
 			"second_args_with_coin",
@@ -331,8 +657,8 @@ func Test_addIbcStats(t *testing.T) {
 				Coin:            coin,
 			}}}}}},
 			[]string{
-				"insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values ('origin2', 'sourceZone2', 'destZone2', '2017-09-11T04:20:49', 19, 1, 'channel2', 3)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + 19,\n            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + 3;",
-				"insert into ibc_transfer_hourly_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount) values ('origin2', 'sourceZone2', 'destZone2', '2017-09-11T04:20:49', 1, 'channel2', 'mydenom', 395812375128394123579823521693778232347132)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update\n        set amount = ibc_transfer_hourly_cashflow.amount + 395812375128394123579823521693778232347132;",
+				"insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values ('origin2', 'sourceZone2', 'destZone2', '2017-09-11T04:20:49', 19, 1, 'channel2', 3)\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + EXCLUDED.txs_cnt,\n            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + EXCLUDED.txs_fail_cnt;",
+				"insert into ibc_transfer_hourly_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount, amount_display, amount_usd)\n    select v.zone, v.zone_src, v.zone_dest, v.hour, v.period, v.ibc_channel, v.denom, v.amount, v.amount / power(10::numeric, m.exponent), v.amount / power(10::numeric, m.exponent) * p.price_usd\n    from (values ('origin2', 'sourceZone2', 'destZone2', timestamp '2017-09-11T04:20:49', 1, 'channel2', 'mydenom', 395812375128394123579823521693778232347132::numeric, 'mydenom')) as v(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount, base_denom)\n        left join denom_traces t on t.zone = v.zone and t.ibc_denom = v.denom\n        left join denom_metadata m on m.denom = coalesce(t.base_denom, v.base_denom)\n        left join token_prices p on p.denom = m.denom and p.hour = v.hour\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update\n        set amount = ibc_transfer_hourly_cashflow.amount + EXCLUDED.amount,\n            amount_display = coalesce((ibc_transfer_hourly_cashflow.amount + EXCLUDED.amount) * EXCLUDED.amount_display / nullif(EXCLUDED.amount, 0),\n                ibc_transfer_hourly_cashflow.amount_display),\n            amount_usd = coalesce((ibc_transfer_hourly_cashflow.amount + EXCLUDED.amount) * EXCLUDED.amount_usd / nullif(EXCLUDED.amount, 0),\n                ibc_transfer_hourly_cashflow.amount_usd);",
 			},
 		},
 	}
@@ -343,3 +669,313 @@ func Test_addIbcStats(t *testing.T) {
 		})
 	}
 }
+
+func Test_addPendingIbcTransfers(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	type args struct {
+		origin    string
+		transfers []processor.PendingIbcTransfer
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+	}{
+		{
+			"failed_without_coins",
+			args{"origin1", []processor.PendingIbcTransfer{{Channel: "channel-7", Hour: timeArgs, Source: true, Failed: true, TxHash: "hash1"}}},
+			"insert into pending_ibc_transfers(zone, ibc_channel, hour, is_source, is_failed, tx_hash, denoms, amounts) values ('origin1', 'channel-7', '2006-01-02T15:00:00', true, true, 'hash1', array[]::text[], array[]::numeric[]);",
+		},
+		{
+			"received_coins",
+			args{"origin2", []processor.PendingIbcTransfer{{Channel: "channel-8", Hour: timeArgs, TxHash: "hash2", Amount: []struct {
+				Amount *big.Int
+				Coin   string
+			}{{big.NewInt(10), "uatom"}, {big.NewInt(20), "uosmo"}}}}},
+			"insert into pending_ibc_transfers(zone, ibc_channel, hour, is_source, is_failed, tx_hash, denoms, amounts) values ('origin2', 'channel-8', '2006-01-02T15:00:00', false, false, 'hash2', array['uatom','uosmo']::text[], array[10,20]::numeric[]);",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addPendingIbcTransfers(tt.args.origin, tt.args.transfers)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_resolvePendingIbcTransfers(t *testing.T) {
+	returning := "\n    returning p.zone, p.ibc_channel, p.hour, p.is_source, p.is_failed, p.tx_hash, p.denoms, p.amounts::text[], cl.chain_id, ch.closed_at is not null;"
+	assert.Contains(t, resolvePendingIbcTransfers("origin1"), "and cl.chain_id is not null and p.zone = 'origin1'"+returning)
+	assert.Contains(t, resolvePendingIbcTransfers(""), "and cl.chain_id is not null"+returning)
+}
+
+func Test_recalculateChannelSupply(t *testing.T) {
+	from := time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, "update ibc_channel_hourly_supply s\n    set outstanding_amount = c.outstanding_amount\n    from (\n        select zone, ibc_channel, hour, denom,\n"+
+		"            sum(sent_amount - received_amount) over (partition by zone, ibc_channel, denom order by hour) as outstanding_amount\n"+
+		"        from ibc_channel_hourly_supply\n            where zone = 'origin1' and ibc_channel = 'channel-0') as c\n"+
+		"    where s.zone = c.zone and s.ibc_channel = c.ibc_channel and s.hour = c.hour and s.denom = c.denom\n"+
+		"        and s.hour >= '2021-07-01T10:00:00'\n        and s.outstanding_amount is distinct from c.outstanding_amount;", recalculateChannelSupply("origin1", "channel-0", from))
+}
+
+func Test_addDenomTraces(t *testing.T) {
+	type args struct {
+		origin string
+		traces map[string]processor.DenomTrace
+	}
+	trace := processor.NewDenomTrace("channel-0", "uatom", "cosmoshub-4")
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+	}{
+		{
+			"empty_args",
+			args{},
+			"insert into denom_traces(zone, ibc_denom, path, base_denom, origin_zone) values \n    on conflict (zone, ibc_denom) do nothing;",
+		},
+		{
+			"first_args",
+			args{"osmosis-1", map[string]processor.DenomTrace{trace.IbcDenom: trace}},
+			"insert into denom_traces(zone, ibc_denom, path, base_denom, origin_zone) values ('osmosis-1', 'ibc/27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2', 'transfer/channel-0', 'uatom', 'cosmoshub-4')\n    on conflict (zone, ibc_denom) do nothing;",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addDenomTraces(tt.args.origin, tt.args.traces)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_addChannelSupply(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	type args struct {
+		origin  string
+		ibcData map[string]map[string]map[string]map[time.Time]*processor.IbcCounters
+	}
+	coin := map[string]*big.Int{"transfer/channel-141/uatom": big.NewInt(500)}
+	tests := []struct {
+		name     string
+		args     args
+		expected string
+	}{
+		{"empty_args", args{}, ""},
+		{
+			"failed_only",
+			args{"origin1", map[string]map[string]map[string]map[time.Time]*processor.IbcCounters{"origin1": {"destZone1": {"channel-0": {timeArgs: &processor.IbcCounters{
+				Transfers:       1,
+				FailedTransfers: 1,
+			}}}}}},
+			"",
+		},
+		{
+			"sent",
+			args{"origin1", map[string]map[string]map[string]map[time.Time]*processor.IbcCounters{"origin1": {"destZone1": {"channel-0": {timeArgs: &processor.IbcCounters{
+				Transfers: 1,
+				Coin:      map[string]*big.Int{"uatom": big.NewInt(1000)},
+			}}}}}},
+			"insert into ibc_channel_hourly_supply(zone, ibc_channel, hour, denom, sent_amount, received_amount, outstanding_amount)\n    select r.zone, r.ibc_channel, r.hour, r.denom, r.sent_amount, r.received_amount,\n        coalesce((select s.outstanding_amount from ibc_channel_hourly_supply s\n            where s.zone = r.zone and s.ibc_channel = r.ibc_channel and s.denom = r.denom and s.hour < r.hour\n            order by s.hour desc limit 1), 0) + r.sent_amount - r.received_amount\n    from (\n        select v.zone, v.ibc_channel, v.hour, coalesce(t.base_denom, v.denom) as denom, sum(v.sent_amount) as sent_amount, sum(v.received_amount) as received_amount\n        from (values ('origin1', 'channel-0', timestamp '2006-01-02T15:00:00', 'uatom', 1000::numeric, 0::numeric)) as v(zone, ibc_channel, hour, denom, sent_amount, received_amount)\n            left join denom_traces t on t.zone = v.zone and t.ibc_denom = v.denom and t.path = 'transfer/' || v.ibc_channel\n        group by v.zone, v.ibc_channel, v.hour, coalesce(t.base_denom, v.denom)) as r\n    on conflict (zone, ibc_channel, hour, denom) do update\n        set sent_amount = ibc_channel_hourly_supply.sent_amount + EXCLUDED.sent_amount,\n            received_amount = ibc_channel_hourly_supply.received_amount + EXCLUDED.received_amount,\n            outstanding_amount = ibc_channel_hourly_supply.outstanding_amount + EXCLUDED.sent_amount - EXCLUDED.received_amount;",
+		},
+		{
+			"received_back",
+			args{"origin1", map[string]map[string]map[string]map[time.Time]*processor.IbcCounters{"sourceZone1": {"origin1": {"channel-0": {timeArgs: &processor.IbcCounters{
+				Transfers: 1,
+				Coin:      coin,
+			}}}}}},
+			"insert into ibc_channel_hourly_supply(zone, ibc_channel, hour, denom, sent_amount, received_amount, outstanding_amount)\n    select r.zone, r.ibc_channel, r.hour, r.denom, r.sent_amount, r.received_amount,\n        coalesce((select s.outstanding_amount from ibc_channel_hourly_supply s\n            where s.zone = r.zone and s.ibc_channel = r.ibc_channel and s.denom = r.denom and s.hour < r.hour\n            order by s.hour desc limit 1), 0) + r.sent_amount - r.received_amount\n    from (\n        select v.zone, v.ibc_channel, v.hour, coalesce(t.base_denom, v.denom) as denom, sum(v.sent_amount) as sent_amount, sum(v.received_amount) as received_amount\n        from (values ('origin1', 'channel-0', timestamp '2006-01-02T15:00:00', 'uatom', 0::numeric, 500::numeric)) as v(zone, ibc_channel, hour, denom, sent_amount, received_amount)\n            left join denom_traces t on t.zone = v.zone and t.ibc_denom = v.denom and t.path = 'transfer/' || v.ibc_channel\n        group by v.zone, v.ibc_channel, v.hour, coalesce(t.base_denom, v.denom)) as r\n    on conflict (zone, ibc_channel, hour, denom) do update\n        set sent_amount = ibc_channel_hourly_supply.sent_amount + EXCLUDED.sent_amount,\n            received_amount = ibc_channel_hourly_supply.received_amount + EXCLUDED.received_amount,\n            outstanding_amount = ibc_channel_hourly_supply.outstanding_amount + EXCLUDED.sent_amount - EXCLUDED.received_amount;",
+		},
+		{
+			"base_denom_and_voucher",
+			args{"origin1", map[string]map[string]map[string]map[time.Time]*processor.IbcCounters{
+				"origin1":   {"destZone1": {"channel-0": {timeArgs: &processor.IbcCounters{Transfers: 1, Coin: map[string]*big.Int{"ibc/HASH": big.NewInt(300)}}}}},
+				"destZone1": {"origin1": {"channel-0": {timeArgs: &processor.IbcCounters{Transfers: 1, Coin: map[string]*big.Int{"uosmo": big.NewInt(1000)}}}}},
+			}},
+			fmt.Sprintf(addChannelSupplyQuery, "('origin1', 'channel-0', timestamp '2006-01-02T15:00:00', 'ibc/HASH', 300::numeric, 0::numeric),"+
+				"('origin1', 'channel-0', timestamp '2006-01-02T15:00:00', 'uosmo', 0::numeric, 1000::numeric)"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := addChannelSupply(tt.args.origin, tt.args.ibcData)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_addTokenPrices(t *testing.T) {
+	assert.Equal(t, "", addTokenPrices(nil))
+
+	hour := time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	query := "insert into token_prices(denom, hour, price_usd, updated_at)\n" +
+		"    select denom, hour, price_usd, now() from (values ('uatom', timestamp '2021-07-01T10:00:00', 12.5::numeric), ('uosmo', timestamp '2021-07-01T11:00:00', 0.000001::numeric)) as v(denom, hour, price_usd)\n" +
+		"    on conflict (denom, hour) do update\n        set price_usd = EXCLUDED.price_usd,\n            updated_at = EXCLUDED.updated_at\n" +
+		"        where token_prices.price_usd is distinct from EXCLUDED.price_usd;"
+	assert.Equal(t, query, addTokenPrices([]prices.Price{{Denom: "uosmo", Hour: hour.Add(90 * time.Minute), USD: 0.000001}, {Denom: "uatom", Hour: hour, USD: 12.5}}))
+
+	// prices of the same hour and repeated rows are merged, the last one wins
+	assert.Equal(t, query, addTokenPrices([]prices.Price{
+		{Denom: "uatom", Hour: hour, USD: 11},
+		{Denom: "uosmo", Hour: hour.Add(time.Hour), USD: 0.000001},
+		{Denom: "uatom", Hour: hour.Add(30 * time.Minute), USD: 12.5},
+		{Denom: "uosmo", Hour: hour.Add(time.Hour), USD: 0.000001},
+	}))
+}
+
+func Test_changedPrices(t *testing.T) {
+	assert.Equal(t, "select min(hour), max(hour), max(updated_at) from token_prices\n    where updated_at > '2021-07-01T10:15:30.25';",
+		changedPrices(time.Date(2021, 7, 1, 10, 15, 30, 250000000, time.UTC)))
+}
+
+func Test_repriceStats(t *testing.T) {
+	from := time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	actual := repriceStats(from, from.Add(2*time.Hour))
+	assert.Len(t, actual, 3)
+	for _, query := range actual {
+		assert.Contains(t, query, "'2021-07-01T10:00:00'")
+		assert.Contains(t, query, "'2021-07-01T12:00:00'")
+	}
+	assert.Equal(t, "insert into rollup_queue(zone, hour)\n    select zone, hour from total_coin_turnover_hourly_stats\n        where period = 1 and hour >= '2021-07-01T10:00:00' and hour < '2021-07-01T12:00:00'\n"+
+		"    union\n    select zone, hour from ibc_transfer_hourly_cashflow\n        where period = 1 and hour >= '2021-07-01T10:00:00' and hour < '2021-07-01T12:00:00'\n    on conflict (zone, hour) do nothing;", actual[2])
+}
+
+func Test_markRollupHour(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:04:05")
+	actual := markRollupHour("myChainID", timeArgs)
+	assert.Equal(t, "insert into rollup_queue(zone, hour) values ('myChainID', '2006-01-02T15:00:00')\n    on conflict (zone, hour) do nothing;", actual)
+}
+
+func Test_deferRollupPeriod(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2021-07-01T00:00:00")
+	assert.Equal(t, "insert into rollup_periods(zone, hour, period) values ('myChainID', '2021-07-01T00:00:00', 720)\n    on conflict (zone, hour, period) do nothing;", deferRollupPeriod("myChainID", Month, timeArgs))
+}
+
+func Test_rollupStats(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2021-07-01T00:00:00")
+	actual := rollupStats("myChainID", Month, timeArgs)
+	assert.Equal(t, []string{
+		"delete from total_tx_hourly_stats\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';",
+		"insert into total_tx_hourly_stats(zone, hour, txs_cnt, txs_w_ibc_xfer_cnt, period, txs_w_ibc_xfer_fail_cnt, total_coin_turnover_amount, new_addresses_cnt)\n    select zone, '2021-07-01T00:00:00', sum(txs_cnt), sum(txs_w_ibc_xfer_cnt), 720, sum(txs_w_ibc_xfer_fail_cnt), sum(total_coin_turnover_amount), sum(new_addresses_cnt) from total_tx_hourly_stats\n        where zone = 'myChainID' and period = 1 and hour >= '2021-07-01T00:00:00' and hour < '2021-08-01T00:00:00'\n        group by zone\n    on conflict (hour, zone, period) do update\n        set txs_cnt = EXCLUDED.txs_cnt,\n            txs_w_ibc_xfer_cnt = EXCLUDED.txs_w_ibc_xfer_cnt,\n            txs_w_ibc_xfer_fail_cnt = EXCLUDED.txs_w_ibc_xfer_fail_cnt,\n            total_coin_turnover_amount = EXCLUDED.total_coin_turnover_amount,\n            new_addresses_cnt = EXCLUDED.new_addresses_cnt;",
+		"delete from total_coin_turnover_hourly_stats\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';",
+		"insert into total_coin_turnover_hourly_stats(zone, hour, period, denom, amount, amount_display, amount_usd)\n    select zone, '2021-07-01T00:00:00', 720, denom, sum(amount), sum(amount_display), sum(amount_usd) from total_coin_turnover_hourly_stats\n        where zone = 'myChainID' and period = 1 and hour >= '2021-07-01T00:00:00' and hour < '2021-08-01T00:00:00'\n        group by zone, denom\n    on conflict (zone, hour, period, denom) do update\n        set amount = EXCLUDED.amount,\n            amount_display = EXCLUDED.amount_display,\n            amount_usd = EXCLUDED.amount_usd;",
+		"delete from active_addresses\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';",
+		"insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)\n    select address, zone, '2021-07-01T00:00:00', 720, bool_or(is_internal_tx), bool_or(is_internal_transfer), bool_or(is_external_transfer), bool_or(is_internal_receive), bool_or(is_external_receive),\n            (array_agg(address_payload) filter (where address_payload is not null))[1] from active_addresses\n        where zone = 'myChainID' and period = 1 and hour >= '2021-07-01T00:00:00' and hour < '2021-08-01T00:00:00'\n        group by address, zone\n    on conflict (address, zone, hour, period) do update\n        set is_internal_tx = EXCLUDED.is_internal_tx,\n            is_internal_transfer = EXCLUDED.is_internal_transfer,\n            is_external_transfer = EXCLUDED.is_external_transfer,\n            is_internal_receive = EXCLUDED.is_internal_receive,\n            is_external_receive = EXCLUDED.is_external_receive,\n            address_payload = EXCLUDED.address_payload;",
+		"delete from message_types_hourly_stats\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';",
+		"insert into message_types_hourly_stats(zone, hour, period, msg_type, msgs_cnt, msgs_fail_cnt)\n    select zone, '2021-07-01T00:00:00', 720, msg_type, sum(msgs_cnt), sum(msgs_fail_cnt) from message_types_hourly_stats\n        where zone = 'myChainID' and period = 1 and hour >= '2021-07-01T00:00:00' and hour < '2021-08-01T00:00:00'\n        group by zone, msg_type\n    on conflict (zone, hour, period, msg_type) do update\n        set msgs_cnt = EXCLUDED.msgs_cnt,\n            msgs_fail_cnt = EXCLUDED.msgs_fail_cnt;",
+		"delete from block_hourly_stats\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';",
+		"insert into block_hourly_stats(zone, hour, period, blocks_cnt, empty_blocks_cnt, txs_cnt, msgs_cnt, intervals_cnt, interval_sum_ms, interval_max_ms)\n    select zone, '2021-07-01T00:00:00', 720, sum(blocks_cnt), sum(empty_blocks_cnt), sum(txs_cnt), sum(msgs_cnt), sum(intervals_cnt), sum(interval_sum_ms), max(interval_max_ms) from block_hourly_stats\n        where zone = 'myChainID' and period = 1 and hour >= '2021-07-01T00:00:00' and hour < '2021-08-01T00:00:00'\n        group by zone\n    on conflict (zone, hour, period) do update\n        set blocks_cnt = EXCLUDED.blocks_cnt,\n            empty_blocks_cnt = EXCLUDED.empty_blocks_cnt,\n            txs_cnt = EXCLUDED.txs_cnt,\n            msgs_cnt = EXCLUDED.msgs_cnt,\n            intervals_cnt = EXCLUDED.intervals_cnt,\n            interval_sum_ms = EXCLUDED.interval_sum_ms,\n            interval_max_ms = EXCLUDED.interval_max_ms;",
+		"delete from ibc_transfer_hourly_stats\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';",
+		"insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt)\n    select zone, zone_src, zone_dest, '2021-07-01T00:00:00', sum(txs_cnt), 720, ibc_channel, sum(txs_fail_cnt) from ibc_transfer_hourly_stats\n        where zone = 'myChainID' and period = 1 and hour >= '2021-07-01T00:00:00' and hour < '2021-08-01T00:00:00'\n        group by zone, zone_src, zone_dest, ibc_channel\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update\n        set txs_cnt = EXCLUDED.txs_cnt,\n            txs_fail_cnt = EXCLUDED.txs_fail_cnt;",
+		"delete from ibc_transfer_hourly_cashflow\n    where zone = 'myChainID' and period = 720 and hour = '2021-07-01T00:00:00';",
+		"insert into ibc_transfer_hourly_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount, amount_display, amount_usd)\n    select zone, zone_src, zone_dest, '2021-07-01T00:00:00', 720, ibc_channel, denom, sum(amount), sum(amount_display), sum(amount_usd) from ibc_transfer_hourly_cashflow\n        where zone = 'myChainID' and period = 1 and hour >= '2021-07-01T00:00:00' and hour < '2021-08-01T00:00:00'\n        group by zone, zone_src, zone_dest, ibc_channel, denom\n    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update\n        set amount = EXCLUDED.amount,\n            amount_display = EXCLUDED.amount_display,\n            amount_usd = EXCLUDED.amount_usd;",
+	}, actual)
+}
+
+// statements which Commit sent per address and per channel before they were written in bulk
+const (
+	perRowActiveAddressesQuery = `insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer) values %s
+    on conflict (address, zone, hour, period) do update
+        set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,
+			is_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,
+			is_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer;`
+	perRowIbcStatsQuery = `insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values %s
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update
+        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + %d,
+            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + %d;`
+	perRowIbcCashflowQuery = `insert into ibc_transfer_hourly_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount) values %s
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update
+        set amount = ibc_transfer_hourly_cashflow.amount + %d;`
+)
+
+// perRowStatements returns the original per row statements of the block, they are the baseline of the benchmark
+func perRowStatements(stats processor.TxStats, ibcData processor.IbcData) []string {
+	statements := make([]string, 0, len(stats.Addresses))
+	for _, address := range stats.Addresses {
+		statements = append(statements, fmt.Sprintf(perRowActiveAddressesQuery,
+			fmt.Sprintf("('%s', '%s', '%s', %d, %t, %t, %t)", address.Address, stats.ChainID, stats.Hour.Format(Format), 1,
+				address.IsInternalTx, address.IsInternalTransfer, address.IsExternalTransfer)))
+	}
+	for source, destMap := range ibcData {
+		for dest, channelMap := range destMap {
+			for channel, hourMap := range channelMap {
+				for hour, count := range hourMap {
+					statements = append(statements, fmt.Sprintf(perRowIbcStatsQuery,
+						fmt.Sprintf("('%s', '%s', '%s', '%s', %d, %d, '%s', %d)", stats.ChainID, source, dest, hour.Format(Format), count.Transfers, 1, channel, count.FailedTransfers),
+						count.Transfers, count.FailedTransfers))
+					for denom, amount := range count.Coin {
+						statements = append(statements, fmt.Sprintf(perRowIbcCashflowQuery,
+							fmt.Sprintf("('%s', '%s', '%s', '%s', %d, '%s', '%s', %d)", stats.ChainID, source, dest, hour.Format(Format), 1, channel, denom, amount),
+							amount))
+					}
+				}
+			}
+		}
+	}
+	return statements
+}
+
+func benchmarkBlock(addresses, channels int) (processor.TxStats, processor.IbcData) {
+	hour, _ := time.Parse("2006-01-02T15:04:05", "2006-01-02T15:00:00")
+	stats := processor.TxStats{ChainID: "origin", Hour: hour}
+	for i := 0; i < addresses; i++ {
+		stats.Addresses = append(stats.Addresses, &processor.AddressData{Address: fmt.Sprintf("cosmos1address%d", i), IsInternalTx: true})
+	}
+	ibcData := processor.IbcData{}
+	for i := 0; i < channels; i++ {
+		ibcData.Append("origin", fmt.Sprintf("dest%d", i), hour, fmt.Sprintf("channel-%d", i), false, []struct {
+			Amount *big.Int
+			Coin   string
+		}{{big.NewInt(1000), "uatom"}, {big.NewInt(10), "uosmo"}})
+	}
+	return stats, ibcData
+}
+
+// BenchmarkBlockStatements sends statements of a block to the test database set by `postgres_test`
+// the same way Commit does, in one batch, the transaction is rolled back after every run,
+// the benchmark is skipped without the database
+func BenchmarkBlockStatements(b *testing.B) {
+	endpoint := os.Getenv("postgres_test")
+	if len(endpoint) == 0 {
+		b.Skip("postgres_test is not set")
+	}
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, endpoint)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	send := func(b *testing.B, statements []string) {
+		for i := 0; i < b.N; i++ {
+			tx, err := conn.Begin(ctx)
+			if err != nil {
+				b.Fatal(err)
+			}
+			batch := &pgx.Batch{}
+			for _, statement := range statements {
+				batch.Queue(statement)
+			}
+			res := tx.SendBatch(ctx, batch)
+			for range statements {
+				if _, err := res.Exec(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := res.Close(); err != nil {
+				b.Fatal(err)
+			}
+			if err := tx.Rollback(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(len(statements)), "statements/op")
+	}
+
+	stats, ibcData := benchmarkBlock(2000, 50)
+	b.Run("per_row", func(b *testing.B) {
+		send(b, perRowStatements(stats, ibcData))
+	})
+	b.Run("bulk", func(b *testing.B) {
+		send(b, append([]string{addActiveAddressesStats(stats)}, addIbcStats("origin", ibcData)...))
+	})
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/mapofzones/txs-processor/pkg/registry"
+)
+
+// Option configures Postgres processor
+type Option func(*PostgresProcessor)
+
+// WithClosedChannelsExcluded defines whether transfers over closed channels are excluded
+// from ibc transfer stats, they are counted in closed channel stats anyway
+func WithClosedChannelsExcluded(exclude bool) Option {
+	return func(p *PostgresProcessor) {
+		p.excludeClosedChannels = exclude
+	}
+}
+
+// WithChannelCacheSize sets how many channels are kept in counterparty chain cache, zero disables it
+func WithChannelCacheSize(size int) Option {
+	return func(p *PostgresProcessor) {
+		p.channelCache = newChannelCache(size)
+	}
+}
+
+// WithAddressDecoding defines whether bech32 addresses are decoded to store their raw bytes,
+// these are the same for the key on every zone and are used to count users across zones
+func WithAddressDecoding(decode bool) Option {
+	return func(p *PostgresProcessor) {
+		p.decodeAddresses = decode
+	}
+}
+
+// WithAddressPrefixes sets expected bech32 prefix of addresses by zone,
+// addresses of zones without prefix are only checked to be valid bech32
+func WithAddressPrefixes(prefixes map[string]string) Option {
+	return func(p *PostgresProcessor) {
+		p.addressPrefixes = prefixes
+	}
+}
+
+// WithRegistry sets registry zone metadata is taken from, it is written to zones
+// on the first commit and after every reload of the registry
+func WithRegistry(r *registry.Registry) Option {
+	return func(p *PostgresProcessor) {
+		p.registry = r
+	}
+}
+
+// WithDenomMetadata sets display units of denoms, they take precedence over the ones from registry
+func WithDenomMetadata(denoms []registry.Denom) Option {
+	return func(p *PostgresProcessor) {
+		p.denoms = denoms
+	}
+}
+
+// WithCaughtUpThreshold sets lag of block time behind commit time below which zone is marked as caught up,
+// zero leaves is_caught_up of zones as it is
+func WithCaughtUpThreshold(threshold time.Duration) Option {
+	return func(p *PostgresProcessor) {
+		p.caughtUpThreshold = threshold
+	}
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"time"
+
+	watcher "github.com/mapofzones/cosmos-watcher/pkg/types"
+	processor "github.com/mapofzones/txs-processor/pkg/types"
+)
+
+// resolvedTransfer is a parked transfer whose channel counterparty became known
+type resolvedTransfer struct {
+	processor.PendingIbcTransfer
+	Zone         string
+	Counterparty string
+	IsClosed     bool
+}
+
+// ReconcileJob counts parked transfers once their channels are resolved, either by processed blocks
+// or by rows inserted by hand for channels created before indexing
+type ReconcileJob struct {
+	processor *PostgresProcessor
+}
+
+// NewReconcileJob returns instance of reconcile job with its own db connection,
+// options must be the same as the ones of the processor
+func NewReconcileJob(ctx context.Context, dbEndpoint string, opts ...Option) (*ReconcileJob, error) {
+	p, err := NewProcessor(ctx, dbEndpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ReconcileJob{processor: p}, nil
+}
+
+// Run reconciles parked transfers every interval until context is done
+func (j *ReconcileJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rows, err := j.processor.ReconcilePendingTransfers(ctx)
+			if err != nil {
+				log.Println("could not reconcile pending ibc transfers:", err)
+			} else if rows > 0 {
+				log.Println("reconciled pending ibc transfers: ", rows)
+			}
+		case <-ctx.Done():
+			j.processor.conn.Close(context.Background())
+			return
+		}
+	}
+}
+
+// reconcilePendingTransfers counts parked transfers whose channels can be resolved now,
+// zone filter is optional, the transfers are removed from the parking in the same transaction
+func (p *PostgresProcessor) reconcilePendingTransfers(ctx context.Context, origin string) (int64, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.ConnectionError, err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, resolvePendingIbcTransfers(origin))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	var transfers []resolvedTransfer
+	for rows.Next() {
+		var transfer resolvedTransfer
+		var denoms, amounts []string
+		if err := rows.Scan(&transfer.Zone, &transfer.Channel, &transfer.Hour, &transfer.Source, &transfer.Failed, &transfer.TxHash,
+			&denoms, &amounts, &transfer.Counterparty, &transfer.IsClosed); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+		}
+		for i := range denoms {
+			amount, ok := new(big.Int).SetString(amounts[i], 10)
+			if !ok {
+				rows.Close()
+				return 0, fmt.Errorf("%w: invalid amount %s of parked transfer %s", processor.CommitError, amounts[i], transfer.TxHash)
+			}
+			transfer.Amount = append(transfer.Amount, struct {
+				Amount *big.Int
+				Coin   string
+			}{amount, denoms[i]})
+		}
+		transfers = append(transfers, transfer)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	if len(transfers) == 0 {
+		return 0, nil
+	}
+
+	for _, query := range p.reconciledStatements(transfers) {
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	return int64(len(transfers)), nil
+}
+
+// reconciledStatements counts resolved transfers the same way as transfers of processed blocks:
+// ibc stats and cashflow, closed channel stats, denom traces and channel supply are updated
+// and the hours are queued for rollup
+func (p *PostgresProcessor) reconciledStatements(transfers []resolvedTransfer) []string {
+	byZone := make(map[string][]resolvedTransfer)
+	var zones []string
+	for _, transfer := range transfers {
+		if _, ok := byZone[transfer.Zone]; !ok {
+			zones = append(zones, transfer.Zone)
+		}
+		byZone[transfer.Zone] = append(byZone[transfer.Zone], transfer)
+	}
+	sort.Strings(zones)
+
+	var queries []string
+	for _, zone := range zones {
+		zp := &PostgresProcessor{
+			excludeClosedChannels: p.excludeClosedChannels,
+			denomTraces:           make(map[string]processor.DenomTrace),
+		}
+		hours := make(map[time.Time]bool)
+		// ledger of the channel is recalculated from the earliest reconciled hour
+		supplyFrom := make(map[string]time.Time)
+		for _, transfer := range byZone[zone] {
+			zp.countIbcTransfer(zone, transfer.Counterparty, transfer.Hour, transfer.IsClosed, transfer.Failed, watcher.IBCTransfer{
+				ChannelID: transfer.Channel,
+				Source:    transfer.Source,
+				Amount:    transfer.Amount,
+			})
+			hours[transfer.Hour] = true
+			if from, ok := supplyFrom[transfer.Channel]; !ok || transfer.Hour.Before(from) {
+				supplyFrom[transfer.Channel] = transfer.Hour
+			}
+		}
+
+		queries = append(queries, addIbcStats(zone, zp.ibcStats)...)
+		if len(zp.denomTraces) > 0 {
+			queries = append(queries, addDenomTraces(zone, zp.denomTraces))
+		}
+		queries = append(queries, addClosedChannelIbcStats(zone, zp.closedIbcStats)...)
+		if supply := addChannelSupply(zone, zp.supplyIbcStats()...); len(supply) > 0 {
+			queries = append(queries, supply)
+			channels := make([]string, 0, len(supplyFrom))
+			for channel := range supplyFrom {
+				channels = append(channels, channel)
+			}
+			sort.Strings(channels)
+			for _, channel := range channels {
+				queries = append(queries, recalculateChannelSupply(zone, channel, supplyFrom[channel]))
+			}
+		}
+
+		sorted := make([]time.Time, 0, len(hours))
+		for hour := range hours {
+			sorted = append(sorted, hour)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+		for _, hour := range sorted {
+			queries = append(queries, markRollupHour(zone, hour))
+		}
+	}
+	return queries
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	processor "github.com/mapofzones/txs-processor/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresProcessor_reconciledStatements(t *testing.T) {
+	hour := time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	coins := func(denom string, amount int64) []struct {
+		Amount *big.Int
+		Coin   string
+	} {
+		return []struct {
+			Amount *big.Int
+			Coin   string
+		}{{big.NewInt(amount), denom}}
+	}
+	transfers := []resolvedTransfer{
+		{
+			PendingIbcTransfer: processor.PendingIbcTransfer{Channel: "channel-0", Hour: hour, Source: false, TxHash: "received", Amount: coins("uosmo", 100)},
+			Zone:               "cosmoshub-4",
+			Counterparty:       "osmosis-1",
+		},
+		{
+			PendingIbcTransfer: processor.PendingIbcTransfer{Channel: "channel-1", Hour: hour, Source: true, Failed: true, TxHash: "closed", Amount: coins("uatom", 5)},
+			Zone:               "cosmoshub-4",
+			Counterparty:       "juno-1",
+			IsClosed:           true,
+		},
+	}
+
+	t.Run("closed_channels_excluded", func(t *testing.T) {
+		p := &PostgresProcessor{excludeClosedChannels: true}
+		trace := processor.NewDenomTrace("channel-0", "uosmo", "osmosis-1")
+		assert.Equal(t, []string{
+			addIbcStats("cosmoshub-4", processor.IbcData{"osmosis-1": {"cosmoshub-4": {"channel-0": {hour: {Transfers: 1, Coin: map[string]*big.Int{"uosmo": big.NewInt(100)}}}}}})[0],
+			addIbcStats("cosmoshub-4", processor.IbcData{"osmosis-1": {"cosmoshub-4": {"channel-0": {hour: {Transfers: 1, Coin: map[string]*big.Int{"uosmo": big.NewInt(100)}}}}}})[1],
+			addDenomTraces("cosmoshub-4", map[string]processor.DenomTrace{trace.IbcDenom: trace}),
+			addClosedChannelIbcStats("cosmoshub-4", processor.IbcData{"cosmoshub-4": {"juno-1": {"channel-1": {hour: {Transfers: 1, FailedTransfers: 1}}}}})[0],
+			addChannelSupply("cosmoshub-4", processor.IbcData{"osmosis-1": {"cosmoshub-4": {"channel-0": {hour: {Transfers: 1, Coin: map[string]*big.Int{"uosmo": big.NewInt(100)}}}}}}),
+			recalculateChannelSupply("cosmoshub-4", "channel-0", hour),
+			recalculateChannelSupply("cosmoshub-4", "channel-1", hour),
+			markRollupHour("cosmoshub-4", hour),
+		}, p.reconciledStatements(transfers))
+	})
+
+	t.Run("closed_channels_counted", func(t *testing.T) {
+		p := &PostgresProcessor{}
+		queries := p.reconciledStatements(transfers)
+		assert.Len(t, queries, 8)
+		assert.Contains(t, queries[0], "('cosmoshub-4', 'osmosis-1', 'cosmoshub-4', '2021-07-01T10:00:00', 1, 1, 'channel-0', 0)")
+		assert.Contains(t, queries[0], "('cosmoshub-4', 'cosmoshub-4', 'juno-1', '2021-07-01T10:00:00', 1, 1, 'channel-1', 1)")
+		assert.Contains(t, queries[3], "ibc_transfer_hourly_closed_channel_stats")
+		assert.Equal(t, markRollupHour("cosmoshub-4", hour), queries[7])
+	})
+}
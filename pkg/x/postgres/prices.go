@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mapofzones/txs-processor/pkg/prices"
+)
+
+// PriceJob imports prices to token prices table and reprices hourly stats of hours whose prices changed,
+// without source it only reprices stats from prices which other jobs put to the table,
+// prices are changed if their updated_at is later than the last check
+type PriceJob struct {
+	conn      *pgx.Conn
+	source    prices.Source
+	checkedAt time.Time
+}
+
+// NewPriceJob returns instance of price job with its own db connection, source can be nil,
+// prices changed before the job is created are not repriced
+func NewPriceJob(ctx context.Context, dbEndpoint string, source prices.Source) (*PriceJob, error) {
+	conn, err := pgx.Connect(ctx, dbEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	j := &PriceJob{
+		conn:   conn,
+		source: source,
+	}
+	if err := conn.QueryRow(ctx, lastPriceUpdateQuery).Scan(&j.checkedAt); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return j, nil
+}
+
+// Run imports prices every interval until context is done
+func (j *PriceJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := j.Import(ctx); err != nil {
+				log.Println("could not import prices:", err)
+			}
+		case <-ctx.Done():
+			j.conn.Close(context.Background())
+			return
+		}
+	}
+}
+
+// Import reads prices from source and reprices hours whose prices are new or changed,
+// including the ones other jobs changed since the last import
+func (j *PriceJob) Import(ctx context.Context) error {
+	if j.source != nil {
+		imported, err := j.source.Prices(ctx)
+		if err != nil {
+			return err
+		}
+		if query := addTokenPrices(imported); len(query) > 0 {
+			if _, err := j.conn.Exec(ctx, query); err != nil {
+				return err
+			}
+		}
+	}
+
+	var from, to, updatedAt *time.Time
+	if err := j.conn.QueryRow(ctx, changedPrices(j.checkedAt)).Scan(&from, &to, &updatedAt); err != nil {
+		return err
+	}
+	if from == nil {
+		return nil
+	}
+	if err := j.Reprice(ctx, *from, to.Add(time.Hour)); err != nil {
+		return err
+	}
+	j.checkedAt = *updatedAt
+	return nil
+}
+
+// Reprice recalculates display and usd amounts of hourly stats during [from, to)
+// and queues the hours for rollup, it is used when prices or denom metadata are corrected
+func (j *PriceJob) Reprice(ctx context.Context, from, to time.Time) error {
+	tx, err := j.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, query := range repriceStats(from, to) {
+		if _, err := tx.Exec(ctx, query); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
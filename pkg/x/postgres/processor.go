@@ -4,9 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"reflect"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	watcher "github.com/mapofzones/cosmos-watcher/pkg/types"
+	"github.com/mapofzones/txs-processor/pkg/hll"
+	"github.com/mapofzones/txs-processor/pkg/registry"
 	processor "github.com/mapofzones/txs-processor/pkg/types"
 )
 
@@ -14,30 +18,63 @@ import (
 var _ processor.Processor = &PostgresProcessor{}
 
 type PostgresProcessor struct {
-	conn          *pgx.Conn
-	txStats       *processor.TxStats
-	ibcStats      processor.IbcData
-	clients       map[string]string
-	connections   map[string]string
-	channels      map[string]string
-	channelStates map[string]bool
+	conn           *pgx.Conn
+	txStats        *processor.TxStats
+	ibcStats       processor.IbcData
+	closedIbcStats processor.IbcData
+	pendingIbc     []processor.PendingIbcTransfer
+	clients        map[string]string
+	connections    map[string]string
+	channels       map[string]string
+	channelStates  map[string]bool
+	closedChannels map[string]time.Time
+	denomTraces    map[string]processor.DenomTrace
+	messageStats   processor.MessageStats
+
+	// kept between blocks
+	channelCache *channelCache
+	hourSketches map[string]hourSketches
+
+	excludeClosedChannels bool
+	decodeAddresses       bool
+	addressPrefixes       map[string]string
+	caughtUpThreshold     time.Duration
+
+	registry        *registry.Registry
+	registryVersion uint64
+	denoms          []registry.Denom
+	denomsVersion   uint64
+	denomsCommitted bool
 }
 
+// DefaultChannelCacheSize is a number of channels kept in counterparty chain cache by default
+const DefaultChannelCacheSize = 10000
+
 // NewProcessor returns instance of Postgres processor
-func NewProcessor(ctx context.Context, dbEndpoint string) (*PostgresProcessor, error) {
+func NewProcessor(ctx context.Context, dbEndpoint string, opts ...Option) (*PostgresProcessor, error) {
 	conn, err := pgx.Connect(ctx, dbEndpoint)
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresProcessor{
-		conn:          conn,
-		clients:       make(map[string]string),
-		connections:   make(map[string]string),
-		channels:      make(map[string]string),
-		channelStates: make(map[string]bool),
-		txStats:       nil,
-		ibcStats:      nil,
-	}, nil
+	p := &PostgresProcessor{
+		conn:           conn,
+		clients:        make(map[string]string),
+		connections:    make(map[string]string),
+		channels:       make(map[string]string),
+		channelStates:  make(map[string]bool),
+		closedChannels: make(map[string]time.Time),
+		denomTraces:    make(map[string]processor.DenomTrace),
+		hourSketches:   make(map[string]hourSketches),
+		txStats:        nil,
+		ibcStats:       nil,
+		closedIbcStats: nil,
+		pendingIbc:     nil,
+		channelCache:   newChannelCache(DefaultChannelCacheSize),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
 }
 
 // Validate checks if the block that we received is at valid height
@@ -57,6 +94,12 @@ func (p *PostgresProcessor) Validate(ctx context.Context, b watcher.Block) error
 
 func (p *PostgresProcessor) Handler(watcher.Message) func(context.Context, processor.MessageMetadata, watcher.Message) error {
 	return func(ctx context.Context, metadata processor.MessageMetadata, msg watcher.Message) error {
+		// messages inside txs are handled by this handler as well, except the ones of rejected txs
+		if tx, ok := msg.(watcher.Transaction); ok {
+			p.messageStats.Add(messageType(msg), !tx.Accepted)
+		} else {
+			p.messageStats.Add(messageType(msg), metadata.TxMetadata != nil && !metadata.TxMetadata.Accepted)
+		}
 
 		switch msg := msg.(type) {
 		case watcher.Transaction:
@@ -88,13 +131,39 @@ func (p *PostgresProcessor) Handler(watcher.Message) func(context.Context, proce
 	}
 }
 
+// Reset drops data gathered for the block, it is used when the block is not going to be committed
+func (p *PostgresProcessor) Reset() {
+	p.reset()
+}
+
+// Resync moves last processed block of the zone right before the block, so the block is accepted,
+// it returns number of blocks which are missed, zones without processed blocks are not resynced
+func (p *PostgresProcessor) Resync(ctx context.Context, b watcher.Block) (int64, error) {
+	dbHeight, err := p.LastProcessedBlock(ctx, b.ChainID())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.ConnectionError, err)
+	}
+	if dbHeight == 0 || b.Height()-dbHeight <= 1 {
+		return 0, nil
+	}
+	if _, err := p.conn.Exec(ctx, resyncBlock(b.ChainID(), b.Height()-1)); err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.ConnectionError, err)
+	}
+	return b.Height() - 1 - dbHeight, nil
+}
+
 func (p *PostgresProcessor) reset() {
 	p.txStats = nil
 	p.ibcStats = nil
+	p.closedIbcStats = nil
+	p.pendingIbc = nil
 	p.clients = make(map[string]string)
 	p.connections = make(map[string]string)
 	p.channels = make(map[string]string)
 	p.channelStates = make(map[string]bool)
+	p.closedChannels = make(map[string]time.Time)
+	p.denomTraces = make(map[string]processor.DenomTrace)
+	p.messageStats = nil
 }
 
 func (p *PostgresProcessor) Commit(ctx context.Context, block watcher.Block) error {
@@ -105,23 +174,57 @@ func (p *PostgresProcessor) Commit(ctx context.Context, block watcher.Block) err
 	batch := &pgx.Batch{}
 
 	// add zone
-	batch.Queue((addZone(block.ChainID())))
+	batch.Queue(addZone(block.ChainID(), p.registryChain))
 
 	// mark block as processed
-	batch.Queue(markBlock(block.ChainID()))
+	now := time.Now()
+	lag := now.Sub(block.Time())
+	batch.Queue(markBlock(block.ChainID(), now, block.Time()))
+	if p.caughtUpThreshold > 0 {
+		batch.Queue(markCaughtUp(block.ChainID(), lag < p.caughtUpThreshold))
+	}
+	batch.Queue(addBlockStats(block))
+
+	// display units are written before amounts which are converted to them
+	denomMetadata, denomsVersion := p.denomMetadata()
+	if len(denomMetadata) > 0 {
+		batch.Queue(denomMetadata)
+	}
 
 	// update TxStats
+	var sketches map[string]*hll.Sketch
 	if p.txStats != nil {
 		batch.Queue(addTxStats(*p.txStats))
-		for _, address := range p.txStats.Addresses {
-			batch.Queue(addActiveAddressesStats(*p.txStats, *address))
+		if turnover := addTxTurnover(*p.txStats); len(turnover) > 0 {
+			batch.Queue(turnover)
+		}
+		if addresses := addActiveAddressesStats(*p.txStats); len(addresses) > 0 {
+			batch.Queue(addresses)
+		}
+		if newAddresses := addNewAddresses(*p.txStats); len(newAddresses) > 0 {
+			batch.Queue(newAddresses)
+		}
+		merged, err := p.mergeAddressSketches(ctx, *p.txStats)
+		if err != nil {
+			return fmt.Errorf("%w: %s", processor.ConnectionError, err.Error())
+		}
+		sketches = merged
+		if query := addAddressSketches(p.txStats.ChainID, p.txStats.Hour, Hour, sketches); len(query) > 0 {
+			batch.Queue(query)
 		}
+		if invalid := addInvalidAddresses(*p.txStats); len(invalid) > 0 {
+			batch.Queue(invalid)
+		}
+	}
+
+	if messages := addMessageStats(block.ChainID(), block.Time(), p.messageStats); len(messages) > 0 {
+		batch.Queue(messages)
 	}
 
 	// insert ibc clients
 	if len(p.clients) > 0 {
 		// add zones to which clients refer
-		zones := addImplicitZones(p.clients)
+		zones := addImplicitZones(p.clients, p.registryChain)
 		if len(zones) > 0 {
 			batch.Queue(zones)
 		}
@@ -129,6 +232,12 @@ func (p *PostgresProcessor) Commit(ctx context.Context, block watcher.Block) err
 		batch.Queue(addClients(block.ChainID(), p.clients))
 	}
 
+	// zone metadata is updated after zones are inserted
+	zonesMetadata, registryVersion := p.zonesMetadata()
+	for _, query := range zonesMetadata {
+		batch.Queue(query)
+	}
+
 	// insert ibc connections
 	if len(p.connections) > 0 {
 		batch.Queue(addConnections(block.ChainID(), p.connections))
@@ -143,12 +252,38 @@ func (p *PostgresProcessor) Commit(ctx context.Context, block watcher.Block) err
 	for channel, state := range p.channelStates {
 		batch.Queue(markChannel(block.ChainID(), channel, state))
 	}
+	for channel, closedAt := range p.closedChannels {
+		batch.Queue(markChannelClosedAt(block.ChainID(), channel, closedAt))
+	}
 
 	// update ibc stats and add untraced zones
 	for _, query := range addIbcStats(block.ChainID(), p.ibcStats) {
 		batch.Queue(query)
 	}
 
+	// insert traces of received vouchers
+	if len(p.denomTraces) > 0 {
+		batch.Queue(addDenomTraces(block.ChainID(), p.denomTraces))
+	}
+
+	// update stats of transfers over closed channels
+	for _, query := range addClosedChannelIbcStats(block.ChainID(), p.closedIbcStats) {
+		batch.Queue(query)
+	}
+
+	// park transfers over unknown channels
+	if len(p.pendingIbc) > 0 {
+		batch.Queue(addPendingIbcTransfers(block.ChainID(), p.pendingIbc))
+	}
+
+	// update outstanding supply of channels, traces are used to account sent vouchers
+	if supply := addChannelSupply(block.ChainID(), p.supplyIbcStats()...); len(supply) > 0 {
+		batch.Queue(supply)
+	}
+
+	// let rollup job recalculate longer periods which include this block, every block has block stats
+	batch.Queue(markRollupHour(block.ChainID(), block.Time()))
+
 	res := p.conn.SendBatch(ctx, batch)
 	defer res.Close()
 
@@ -158,6 +293,166 @@ func (p *PostgresProcessor) Commit(ctx context.Context, block watcher.Block) err
 			return fmt.Errorf("%w: %s", processor.CommitError, err.Error())
 		}
 	}
+	if err := res.Close(); err != nil {
+		return fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+
+	p.cacheCommittedChannels(block.ChainID())
+	p.keepAddressSketches(block.ChainID(), sketches)
+	p.recordLag(block.ChainID(), block.Time())
+	p.registryVersion = registryVersion
+	if len(denomMetadata) > 0 {
+		p.denomsVersion, p.denomsCommitted = denomsVersion, true
+	}
 	log.Println("chain_id: ", block.ChainID(), " height: ", block.Height())
 	return nil
 }
+
+// messageType returns name of the message type, e.g. Transaction or IBCTransfer
+func messageType(msg watcher.Message) string {
+	t := reflect.TypeOf(msg)
+	if t == nil {
+		return "nil"
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// zonesMetadata returns update of zones known to the registry if it was loaded or reloaded since the last commit,
+// zones inserted later get their metadata with the insert
+func (p *PostgresProcessor) zonesMetadata() ([]string, uint64) {
+	if p.registry == nil {
+		return nil, p.registryVersion
+	}
+	version := p.registry.Version()
+	if version == p.registryVersion {
+		return nil, version
+	}
+	return updateZonesMetadata(p.registry.Chains()), version
+}
+
+// registryChain returns metadata of the chain from the registry if it is loaded
+func (p *PostgresProcessor) registryChain(chainID string) (registry.Chain, bool) {
+	if p.registry == nil {
+		return registry.Chain{}, false
+	}
+	return p.registry.Chain(chainID)
+}
+
+// denomMetadata returns upsert of display units of denoms on the first commit and after registry is reloaded
+func (p *PostgresProcessor) denomMetadata() (string, uint64) {
+	version := p.denomsVersion
+	if p.registry != nil {
+		version = p.registry.Version()
+	}
+	if p.denomsCommitted && version == p.denomsVersion {
+		return "", version
+	}
+	var denoms []registry.Denom
+	if p.registry != nil {
+		denoms = append(denoms, p.registry.Denoms()...)
+	}
+	return addDenomMetadata(append(denoms, p.denoms...)), version
+}
+
+// cacheCommittedChannels puts channels created in the block to the cache
+// and drops the ones which were opened or closed
+func (p *PostgresProcessor) cacheCommittedChannels(chainID string) {
+	for channel := range p.channelStates {
+		p.channelCache.Remove(chainID, channel)
+	}
+	for channel, connection := range p.channels {
+		client := p.connections[connection]
+		if counterparty, ok := p.clients[client]; ok && len(counterparty) > 0 {
+			p.channelCache.Add(chainID, channel, ChannelInfo{
+				ConnectionID: connection,
+				ClientID:     client,
+				ChainID:      counterparty,
+				IsOpened:     p.channelStates[channel],
+				IsClosed:     !p.closedChannels[channel].IsZero(),
+			})
+		}
+	}
+}
+
+// WarmChannelCache fills channel cache with opened channels
+func (p *PostgresProcessor) WarmChannelCache(ctx context.Context) error {
+	res, err := p.conn.Query(ctx, fmt.Sprintf(openedChannelsQuery, p.channelCache.size))
+	if err != nil {
+		return fmt.Errorf("%w: %s", processor.ConnectionError, err.Error())
+	}
+	defer res.Close()
+
+	for res.Next() {
+		var zone, channel string
+		info := ChannelInfo{IsOpened: true}
+		if err := res.Scan(&zone, &channel, &info.ConnectionID, &info.ClientID, &info.ChainID); err != nil {
+			return err
+		}
+		p.channelCache.Add(zone, channel, info)
+	}
+	return res.Err()
+}
+
+// RecalculateClosedChannelStats moves stats of transfers which happened after channel close
+// from ibc transfer stats to closed channel stats if closed channels are excluded,
+// otherwise it rebuilds closed channel stats from ibc transfer stats
+func (p *PostgresProcessor) RecalculateClosedChannelStats(ctx context.Context) (int64, error) {
+	queries := []string{rebuildClosedChannelIbcStatsQuery, rebuildClosedChannelIbcCashflowQuery}
+	if p.excludeClosedChannels {
+		queries = []string{moveClosedChannelIbcStatsQuery, moveClosedChannelIbcCashflowQuery}
+	}
+
+	// counts and amounts are recalculated together
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.ConnectionError, err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	var rows int64
+	for _, query := range queries {
+		tag, err := tx.Exec(ctx, query)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+		}
+		rows += tag.RowsAffected()
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	return rows, nil
+}
+
+// BackfillFirstSeenAddresses fills first hours of addresses from active addresses which were written
+// before first seen addresses were kept and recounts new addresses, it returns number of backfilled addresses
+func (p *PostgresProcessor) BackfillFirstSeenAddresses(ctx context.Context) (int64, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.ConnectionError, err.Error())
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, deleteCounterpartyFirstSeenQuery); err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	tag, err := tx.Exec(ctx, backfillFirstSeenAddressesQuery)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	if _, err := tx.Exec(ctx, recountNewAddressesQuery); err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%w: %s", processor.CommitError, err.Error())
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ReconcilePendingTransfers adds parked transfers of all zones to ibc transfer stats
+// if their channels can be resolved now
+func (p *PostgresProcessor) ReconcilePendingTransfers(ctx context.Context) (int64, error) {
+	return p.reconcilePendingTransfers(ctx, "")
+}
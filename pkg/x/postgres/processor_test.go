@@ -0,0 +1,249 @@
+package postgres
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	watcher "github.com/mapofzones/cosmos-watcher/pkg/types"
+	"github.com/mapofzones/txs-processor/pkg/hll"
+	"github.com/mapofzones/txs-processor/pkg/registry"
+	processor "github.com/mapofzones/txs-processor/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresProcessor_zonesMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zones.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"chain_id": "cosmoshub-4", "pretty_name": "Cosmos Hub", "bech32_prefix": "cosmos"},
+		{"chain_id": "osmosis-1", "pretty_name": "Osmosis", "bech32_prefix": "osmo"}]`), 0644))
+	r, err := registry.Load(path)
+	assert.NoError(t, err)
+
+	p := &PostgresProcessor{registry: r, clients: map[string]string{}}
+
+	// zones known to the registry are updated after registry is loaded
+	query, version := p.zonesMetadata()
+	assert.Equal(t, updateZonesMetadata(r.Chains()), query)
+	assert.Equal(t, uint64(1), version)
+	p.registryVersion = version
+
+	// zones indexed later get their metadata when they are inserted, nothing to update until registry is reloaded
+	p.clients = map[string]string{"07-tendermint-0": "osmosis-1", "07-tendermint-1": "unknown-1"}
+	query, _ = p.zonesMetadata()
+	assert.Empty(t, query)
+	assert.Contains(t, addImplicitZones(p.clients, p.registryChain), "('Osmosis', 'osmosis-1', false, false, 'osmo', '', '[]'::jsonb)")
+
+	assert.NoError(t, r.Reload())
+	query, version = p.zonesMetadata()
+	assert.Equal(t, updateZonesMetadata(r.Chains()), query)
+	assert.Equal(t, uint64(2), version)
+
+	// registry prefixes are used unless prefix is configured
+	assert.Equal(t, "osmo", p.addressPrefix("osmosis-1"))
+	assert.Equal(t, "", p.addressPrefix("unknown-1"))
+	p.addressPrefixes = map[string]string{"osmosis-1": "custom"}
+	assert.Equal(t, "custom", p.addressPrefix("osmosis-1"))
+}
+
+func TestPostgresProcessor_denomMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zones.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`[{"chain_id": "cosmoshub-4", "assets": [{"base": "uatom", "display": "atom", "decimals": 6}]}]`), 0644))
+	r, err := registry.Load(path)
+	assert.NoError(t, err)
+
+	// configured denoms take precedence over registry
+	configured := []registry.Denom{{Denom: "uatom", Display: "ATOM", Exponent: 6}, {Denom: "aevmos", Display: "evmos", Exponent: 18}}
+	p := &PostgresProcessor{registry: r, denoms: configured}
+	query, version := p.denomMetadata()
+	assert.Equal(t, addDenomMetadata(configured), query)
+	p.denomsVersion, p.denomsCommitted = version, true
+
+	query, _ = p.denomMetadata()
+	assert.Equal(t, "", query)
+
+	assert.NoError(t, r.Reload())
+	query, _ = p.denomMetadata()
+	assert.Equal(t, addDenomMetadata(configured), query)
+}
+
+type unknownMessage struct{}
+
+func TestPostgresProcessor_HandlerCountsMessageTypes(t *testing.T) {
+	p := &PostgresProcessor{}
+	metadata := processor.MessageMetadata{ChainID: "cosmoshub-4", BlockTime: time.Now()}
+	messages := []watcher.Message{
+		watcher.Transaction{Hash: "accepted", Accepted: true, Sender: "cosmos1sender", Messages: []watcher.Message{watcher.Transfer{Sender: "cosmos1sender"}, unknownMessage{}}},
+		watcher.Transaction{Hash: "rejected", Accepted: false, Sender: "cosmos1sender", Messages: []watcher.Message{watcher.Transfer{Sender: "cosmos1sender"}}},
+		&unknownMessage{},
+	}
+	for _, msg := range messages {
+		assert.NoError(t, p.Handler(msg)(context.Background(), metadata, msg))
+	}
+
+	assert.Equal(t, processor.MessageStats{
+		"Transaction":    {Count: 2, FailedCount: 1},
+		"Transfer":       {Count: 2, FailedCount: 1},
+		"unknownMessage": {Count: 2, FailedCount: 0},
+	}, p.messageStats)
+}
+
+func TestPostgresProcessor_recordLag(t *testing.T) {
+	now := time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	lastBlocks.now = func() time.Time { return now }
+	defer func() { lastBlocks.now = nil }()
+
+	p := &PostgresProcessor{}
+	p.recordLag("noThreshold", now.Add(-90*time.Second))
+	assert.Equal(t, 90.0, lastBlocks.lags().(map[string]float64)["noThreshold"])
+	assert.NotContains(t, lastBlocks.caughtUp(), "noThreshold")
+
+	p.caughtUpThreshold = time.Minute
+	p.recordLag("behind", now.Add(-90*time.Second))
+	p.recordLag("caughtUp", now.Add(-5*time.Second))
+	assert.Equal(t, 0, lastBlocks.caughtUp().(map[string]int)["behind"])
+	assert.Equal(t, 1, lastBlocks.caughtUp().(map[string]int)["caughtUp"])
+	assert.Equal(t, 5.0, lastBlocks.lags().(map[string]float64)["caughtUp"])
+
+	// zone which stopped sending blocks falls behind without new commits
+	now = now.Add(time.Minute)
+	assert.Equal(t, 0, lastBlocks.caughtUp().(map[string]int)["caughtUp"])
+	assert.Equal(t, 65.0, lastBlocks.lags().(map[string]float64)["caughtUp"])
+}
+
+func TestPostgresProcessor_HandlerCountsFailedTransfers(t *testing.T) {
+	p := &PostgresProcessor{channelCache: newChannelCache(10)}
+	p.channelCache.Add("cosmoshub-4", "channel-0", ChannelInfo{ChainID: "osmosis-1", IsOpened: true})
+	p.channelCache.Add("cosmoshub-4", "channel-1", ChannelInfo{ChainID: "juno-1", IsOpened: true})
+	blockTime := time.Date(2021, 7, 1, 10, 15, 0, 0, time.UTC)
+	metadata := processor.MessageMetadata{ChainID: "cosmoshub-4", BlockTime: blockTime}
+	tx := watcher.Transaction{Hash: "rejected", Accepted: false, Sender: "cosmos1sender", Messages: []watcher.Message{
+		watcher.IBCTransfer{ChannelID: "channel-0", Sender: "cosmos1sender", Source: true},
+		watcher.Transfer{Sender: "cosmos1sender"},
+		watcher.IBCTransfer{ChannelID: "channel-0", Sender: "cosmos1sender", Source: true},
+		watcher.IBCTransfer{ChannelID: "channel-1", Sender: "cosmos1sender", Source: true},
+	}}
+	assert.NoError(t, p.Handler(tx)(context.Background(), metadata, tx))
+
+	assert.Equal(t, 1, p.txStats.Count)
+	assert.Equal(t, 1, p.txStats.TxWithIBCTransfer)
+	assert.Equal(t, 1, p.txStats.TxWithIBCTransferFail)
+	assert.Equal(t, processor.MessageStats{
+		"Transaction": {Count: 1, FailedCount: 1},
+		"IBCTransfer": {Count: 3, FailedCount: 3},
+		"Transfer":    {Count: 1, FailedCount: 1},
+	}, p.messageStats)
+
+	hour := blockTime.Truncate(time.Hour)
+	assert.ElementsMatch(t, []processor.IbcStats{
+		{Source: "cosmoshub-4", Destination: "osmosis-1", Channel: "channel-0", Hour: hour, Count: 2, FailedCount: 2},
+		{Source: "cosmoshub-4", Destination: "juno-1", Channel: "channel-1", Hour: hour, Count: 1, FailedCount: 1},
+	}, p.ibcStats.ToIbcStats())
+}
+
+func TestPostgresProcessor_ChannelInfoClosed(t *testing.T) {
+	p := &PostgresProcessor{channelCache: newChannelCache(10), channelStates: map[string]bool{}, closedChannels: map[string]time.Time{}}
+	p.channelCache.Add("cosmoshub-4", "channel-0", ChannelInfo{ChainID: "osmosis-1"})
+	p.channelCache.Add("cosmoshub-4", "channel-1", ChannelInfo{ChainID: "juno-1", IsOpened: true})
+
+	// channel which was never opened is not closed
+	info, err := p.ChannelInfo(context.Background(), "channel-0", "cosmoshub-4")
+	assert.NoError(t, err)
+	assert.False(t, info.IsClosed)
+
+	// channel closed in this block
+	p.channelStates["channel-1"] = false
+	p.closedChannels["channel-1"] = time.Now()
+	info, err = p.ChannelInfo(context.Background(), "channel-1", "cosmoshub-4")
+	assert.NoError(t, err)
+	assert.False(t, info.IsOpened)
+	assert.True(t, info.IsClosed)
+}
+
+func TestPostgresProcessor_countIbcTransferOverExcludedClosedChannel(t *testing.T) {
+	p := &PostgresProcessor{excludeClosedChannels: true, denomTraces: map[string]processor.DenomTrace{}}
+	blockTime := time.Date(2021, 7, 1, 10, 15, 0, 0, time.UTC)
+	p.countIbcTransfer("cosmoshub-4", "osmosis-1", blockTime, true, false, watcher.IBCTransfer{
+		ChannelID: "channel-0",
+		Source:    false,
+		Amount: []struct {
+			Amount *big.Int
+			Coin   string
+		}{{Amount: big.NewInt(100), Coin: "uosmo"}},
+	})
+
+	assert.Nil(t, p.ibcStats)
+	assert.Len(t, p.denomTraces, 1)
+	supply := addChannelSupply("cosmoshub-4", p.supplyIbcStats()...)
+	assert.NotEmpty(t, supply)
+	assert.Equal(t, addChannelSupply("cosmoshub-4", p.closedIbcStats), supply)
+}
+
+func TestPostgresProcessor_mergeAddressSketches(t *testing.T) {
+	hour := time.Date(2021, 7, 1, 10, 0, 0, 0, time.UTC)
+	stored := hll.New()
+	stored.AddString("cosmos1sender")
+	p := &PostgresProcessor{hourSketches: map[string]hourSketches{
+		"cosmoshub-4": {hour: hour, sketches: map[string]*hll.Sketch{RoleAll: stored, RoleInternalTx: stored}},
+	}}
+	stats := processor.TxStats{ChainID: "cosmoshub-4", Hour: hour, Addresses: []*processor.AddressData{
+		{Address: "cosmos1sender", IsInternalTx: true},
+		{Address: "cosmos1recipient", IsInternalReceive: true},
+	}}
+	merged, err := p.mergeAddressSketches(context.Background(), stats)
+	assert.NoError(t, err)
+
+	// sketch of internal txs already has the sender
+	assert.ElementsMatch(t, []string{RoleAll, RoleInternalReceive}, keys(merged))
+	assert.Equal(t, uint64(2), merged[RoleAll].Count())
+	assert.Equal(t, uint64(1), p.hourSketches["cosmoshub-4"].sketches[RoleAll].Count())
+
+	p.keepAddressSketches("cosmoshub-4", merged)
+	assert.Equal(t, uint64(2), p.hourSketches["cosmoshub-4"].sketches[RoleAll].Count())
+	assert.Equal(t, uint64(1), p.hourSketches["cosmoshub-4"].sketches[RoleInternalReceive].Count())
+}
+
+func keys(sketches map[string]*hll.Sketch) []string {
+	roles := make([]string, 0, len(sketches))
+	for role := range sketches {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+func TestPostgresProcessor_HandlerValidatesCounterpartySender(t *testing.T) {
+	p := &PostgresProcessor{
+		channelCache:    newChannelCache(10),
+		addressPrefixes: map[string]string{"cosmoshub-4": "cosmos", "osmosis-1": "osmo"},
+	}
+	p.channelCache.Add("cosmoshub-4", "channel-0", ChannelInfo{ChainID: "osmosis-1", IsOpened: true})
+	metadata := processor.MessageMetadata{ChainID: "cosmoshub-4", BlockTime: time.Now()}
+	tx := watcher.Transaction{Hash: "received", Accepted: true, Sender: "cosmos1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnrk363e", Messages: []watcher.Message{
+		watcher.IBCTransfer{
+			ChannelID: "channel-0",
+			Sender:    "osmo1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5helwsw",
+			Recipient: "cosmos1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnrk363e",
+			Source:    false,
+		},
+	}}
+	assert.NoError(t, p.Handler(tx)(context.Background(), metadata, tx))
+
+	assert.Empty(t, p.txStats.InvalidAddresses)
+	assert.Len(t, p.txStats.Addresses, 2)
+	for _, address := range p.txStats.Addresses {
+		if address.Address == "osmo1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5helwsw" {
+			assert.True(t, address.IsExternalTransfer)
+			return
+		}
+	}
+	t.Error("sender of received transfer is not counted")
+}
@@ -82,26 +82,6 @@ func (p *PostgresProcessor) ChainIDFromChannelID(ctx context.Context, channelID,
 	return "", nil
 }
 
-func (p *PostgresProcessor) GetChannelStatus(ctx context.Context, channelID, originChainID string) (bool, error) {
-	res, err := p.conn.Query(ctx, fmt.Sprintf(statusFromChannelIDQuery, channelID, originChainID))
-	if err != nil {
-		return false, err
-	}
-
-	defer res.Close()
-
-	if res.Next() {
-		isOpened := false
-		err = res.Scan(&isOpened)
-		if err != nil {
-			return false, err
-		}
-		res.Close()
-		return isOpened, nil
-	}
-	return false, nil
-}
-
 // ChainID method returns chain ID related to the given channel_id
 // it checks for local(block) data and does appropriate db queries
 func (p *PostgresProcessor) ChainID(ctx context.Context, channelID, originChainID string) (string, error) {
@@ -122,3 +102,63 @@ func (p *PostgresProcessor) ChainID(ctx context.Context, channelID, originChainI
 	// nothing in cache, query db
 	return p.ChainIDFromChannelID(ctx, channelID, originChainID)
 }
+
+// ChannelInfo describes channel of the zone and the chain on the other side of it,
+// ChainID is empty if the channel can not be resolved,
+// channel is closed once its close is recorded, channels which were never opened are not closed
+type ChannelInfo struct {
+	ConnectionID string
+	ClientID     string
+	ChainID      string
+	IsOpened     bool
+	IsClosed     bool
+}
+
+// ChannelInfo method returns info of the given channel_id with a single db query,
+// it checks for local(block) data and cache first
+func (p *PostgresProcessor) ChannelInfo(ctx context.Context, channelID, originChainID string) (ChannelInfo, error) {
+	info, err := p.channelInfo(ctx, channelID, originChainID)
+	// channel might be opened or closed in this block
+	if state, ok := p.channelStates[channelID]; ok {
+		info.IsOpened = state
+	}
+	if _, ok := p.closedChannels[channelID]; ok {
+		info.IsClosed = true
+	}
+	return info, err
+}
+
+func (p *PostgresProcessor) channelInfo(ctx context.Context, channelID, originChainID string) (ChannelInfo, error) {
+	// channel was created in this block, so it is not in db
+	if connectionID, ok := p.channels[channelID]; ok {
+		chainID, err := p.ChainID(ctx, channelID, originChainID)
+		return ChannelInfo{
+			ConnectionID: connectionID,
+			ClientID:     p.connections[connectionID],
+			ChainID:      chainID,
+		}, err
+	}
+
+	// check channels resolved in previous blocks
+	if info, ok := p.channelCache.Get(originChainID, channelID); ok {
+		return info, nil
+	}
+
+	res, err := p.conn.Query(ctx, fmt.Sprintf(channelInfoQuery, channelID, originChainID))
+	if err != nil {
+		return ChannelInfo{}, err
+	}
+	defer res.Close()
+
+	info := ChannelInfo{}
+	if res.Next() {
+		err = res.Scan(&info.ConnectionID, &info.ClientID, &info.ChainID, &info.IsOpened, &info.IsClosed)
+		if err != nil {
+			return ChannelInfo{}, err
+		}
+	}
+	if len(info.ChainID) > 0 {
+		p.channelCache.Add(originChainID, channelID, info)
+	}
+	return info, res.Err()
+}
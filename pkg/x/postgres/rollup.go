@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Period is a value of `period` column in stats tables, it identifies a calendar period
+// starting at `hour`: hours, days and weeks have fixed length equal to the value in hours,
+// while Month is a calendar month of 28-31 days and its value is nominal 30 days
+type Period int
+
+const (
+	Hour  Period = 1
+	Day   Period = 24
+	Week  Period = 168
+	Month Period = 720
+)
+
+// Start returns beginning of the calendar period which contains given time,
+// weeks start on Monday
+func (p Period) Start(t time.Time) time.Time {
+	t = t.Truncate(time.Hour)
+	switch p {
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case Week:
+		day := Day.Start(t)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return t
+	}
+}
+
+// End returns beginning of the next period
+func (p Period) End(start time.Time) time.Time {
+	switch p {
+	case Day:
+		return start.AddDate(0, 0, 1)
+	case Week:
+		return start.AddDate(0, 0, 7)
+	case Month:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.Add(time.Hour)
+	}
+}
+
+// RollupJob recalculates stats of longer periods from hourly stats,
+// it uses hours which processor marked as changed in rollup queue
+type RollupJob struct {
+	conn    *pgx.Conn
+	periods []Period
+}
+
+// NewRollupJob returns instance of rollup job with its own db connection
+func NewRollupJob(ctx context.Context, dbEndpoint string, periods ...Period) (*RollupJob, error) {
+	conn, err := pgx.Connect(ctx, dbEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &RollupJob{
+		conn:    conn,
+		periods: periods,
+	}, nil
+}
+
+// Run does rollup every interval until context is done
+func (j *RollupJob) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := j.Rollup(ctx); err != nil {
+				log.Println("could not rollup stats:", err)
+			}
+		case <-ctx.Done():
+			j.conn.Close(context.Background())
+			return
+		}
+	}
+}
+
+// Rollup recalculates ended periods which contain queued hours, periods which have not ended yet
+// are deferred until their end, so hourly stats of the current month are not scanned on every run,
+// queues are cleared in the same transaction, so hours marked during rollup are kept for the next run
+func (j *RollupJob) Rollup(ctx context.Context) error {
+	tx, err := j.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	queued, err := popQueuedHours(ctx, tx)
+	if err != nil {
+		return err
+	}
+	deferred, err := popDeferredPeriods(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	for _, item := range j.periodsToRollup(queued, deferred) {
+		if item.period.End(item.hour).After(time.Now().UTC()) {
+			batch.Queue(deferRollupPeriod(item.zone, item.period, item.hour))
+			continue
+		}
+		for _, query := range rollupStats(item.zone, item.period, item.hour) {
+			batch.Queue(query)
+		}
+		sketches, err := loadAddressSketches(ctx, tx, item.zone, item.hour, item.period.End(item.hour))
+		if err != nil {
+			return err
+		}
+		for _, query := range rollupAddressSketches(item.zone, item.period, item.hour, sketches) {
+			batch.Queue(query)
+		}
+	}
+
+	res := tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := res.Exec(); err != nil {
+			res.Close()
+			return err
+		}
+	}
+	if err := res.Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// periodsToRollup returns distinct periods of the job which contain queued hours, together with deferred ones
+func (j *RollupJob) periodsToRollup(queued []queuedHour, deferred []queuedHour) []queuedHour {
+	var periods []queuedHour
+	done := make(map[string]bool)
+	add := func(item queuedHour) {
+		key := fmt.Sprintf("%s/%d/%s", item.zone, item.period, item.hour.Format(Format))
+		if !done[key] {
+			done[key] = true
+			periods = append(periods, item)
+		}
+	}
+	for _, item := range queued {
+		for _, period := range j.periods {
+			add(queuedHour{zone: item.zone, hour: period.Start(item.hour), period: period})
+		}
+	}
+	for _, item := range deferred {
+		add(item)
+	}
+	return periods
+}
+
+// queuedHour is an hour marked for rollup or start of the deferred period
+type queuedHour struct {
+	zone   string
+	hour   time.Time
+	period Period
+}
+
+func popQueuedHours(ctx context.Context, tx pgx.Tx) ([]queuedHour, error) {
+	res, err := tx.Query(ctx, popRollupQueueQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var queued []queuedHour
+	for res.Next() {
+		item := queuedHour{}
+		if err := res.Scan(&item.zone, &item.hour); err != nil {
+			return nil, err
+		}
+		queued = append(queued, item)
+	}
+	return queued, res.Err()
+}
+
+func popDeferredPeriods(ctx context.Context, tx pgx.Tx) ([]queuedHour, error) {
+	res, err := tx.Query(ctx, popRollupPeriodsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var deferred []queuedHour
+	for res.Next() {
+		item := queuedHour{}
+		var period int
+		if err := res.Scan(&item.zone, &item.hour, &period); err != nil {
+			return nil, err
+		}
+		item.period = Period(period)
+		deferred = append(deferred, item)
+	}
+	return deferred, res.Err()
+}
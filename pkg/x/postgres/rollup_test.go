@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriod_Start(t *testing.T) {
+	// 2021-07-15 is Thursday
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2021-07-15T13:47:12")
+	tests := []struct {
+		name          string
+		period        Period
+		expectedStart string
+		expectedEnd   string
+	}{
+		{"hour", Hour, "2021-07-15T13:00:00", "2021-07-15T14:00:00"},
+		{"day", Day, "2021-07-15T00:00:00", "2021-07-16T00:00:00"},
+		{"week", Week, "2021-07-12T00:00:00", "2021-07-19T00:00:00"},
+		{"month", Month, "2021-07-01T00:00:00", "2021-08-01T00:00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.period.Start(timeArgs)
+			assert.Equal(t, tt.expectedStart, start.Format(Format))
+			assert.Equal(t, tt.expectedEnd, tt.period.End(start).Format(Format))
+		})
+	}
+}
+
+func TestPeriod_StartOfWeekOnSunday(t *testing.T) {
+	timeArgs, _ := time.Parse("2006-01-02T15:04:05", "2021-07-18T23:59:59")
+	assert.Equal(t, "2021-07-12T00:00:00", Week.Start(timeArgs).Format(Format))
+}
+
+func TestRollupJob_periodsToRollup(t *testing.T) {
+	j := &RollupJob{periods: []Period{Day, Month}}
+	hour := func(s string) time.Time {
+		t, _ := time.Parse("2006-01-02T15:04:05", s)
+		return t
+	}
+	queued := []queuedHour{
+		{zone: "myChainID", hour: hour("2021-07-15T10:00:00")},
+		{zone: "myChainID", hour: hour("2021-07-15T11:00:00")},
+		{zone: "myChainID", hour: hour("2021-07-16T11:00:00")},
+	}
+	deferred := []queuedHour{
+		{zone: "myChainID", hour: hour("2021-07-01T00:00:00"), period: Month},
+		{zone: "otherChainID", hour: hour("2021-07-14T00:00:00"), period: Day},
+	}
+	assert.Equal(t, []queuedHour{
+		{zone: "myChainID", hour: hour("2021-07-15T00:00:00"), period: Day},
+		{zone: "myChainID", hour: hour("2021-07-01T00:00:00"), period: Month},
+		{zone: "myChainID", hour: hour("2021-07-16T00:00:00"), period: Day},
+		{zone: "otherChainID", hour: hour("2021-07-14T00:00:00"), period: Day},
+	}, j.periodsToRollup(queued, deferred))
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/mapofzones/txs-processor/pkg/hll"
+	processor "github.com/mapofzones/txs-processor/pkg/types"
+)
+
+// roles of active addresses, each of them has its own sketch
+const (
+	RoleAll              = "all"
+	RoleInternalTx       = "internal_tx"
+	RoleInternalTransfer = "internal_transfer"
+	RoleExternalTransfer = "external_transfer"
+	RoleInternalReceive  = "internal_receive"
+	RoleExternalReceive  = "external_receive"
+)
+
+// addressSketches returns sketches of active addresses by role, roles without addresses are omitted
+func addressSketches(addresses []*processor.AddressData) map[string]*hll.Sketch {
+	sketches := make(map[string]*hll.Sketch)
+	add := func(role, address string) {
+		if sketches[role] == nil {
+			sketches[role] = hll.New()
+		}
+		sketches[role].AddString(address)
+	}
+	for _, address := range addresses {
+		add(RoleAll, address.Address)
+		if address.IsInternalTx {
+			add(RoleInternalTx, address.Address)
+		}
+		if address.IsInternalTransfer {
+			add(RoleInternalTransfer, address.Address)
+		}
+		if address.IsExternalTransfer {
+			add(RoleExternalTransfer, address.Address)
+		}
+		if address.IsInternalReceive {
+			add(RoleInternalReceive, address.Address)
+		}
+		if address.IsExternalReceive {
+			add(RoleExternalReceive, address.Address)
+		}
+	}
+	return sketches
+}
+
+// hourSketches are sketches of active addresses of the zone during the hour, they are kept between blocks,
+// so the stored sketches are read once per zone and hour and merged in go
+type hourSketches struct {
+	hour     time.Time
+	sketches map[string]*hll.Sketch
+}
+
+// mergeAddressSketches returns stored sketches of the hour merged with addresses of the block,
+// only roles whose sketches changed are returned, they are kept by keepAddressSketches once committed
+func (p *PostgresProcessor) mergeAddressSketches(ctx context.Context, stats processor.TxStats) (map[string]*hll.Sketch, error) {
+	block := addressSketches(stats.Addresses)
+	if len(block) == 0 {
+		return nil, nil
+	}
+	current, ok := p.hourSketches[stats.ChainID]
+	if !ok || !current.hour.Equal(stats.Hour) {
+		stored, err := loadAddressSketches(ctx, p.conn, stats.ChainID, stats.Hour, stats.Hour.Add(time.Hour))
+		if err != nil {
+			return nil, err
+		}
+		current = hourSketches{hour: stats.Hour, sketches: stored}
+		if p.hourSketches == nil {
+			p.hourSketches = make(map[string]hourSketches)
+		}
+		p.hourSketches[stats.ChainID] = current
+	}
+
+	changed := make(map[string]*hll.Sketch)
+	for role, sketch := range block {
+		merged := hll.New()
+		if stored, ok := current.sketches[role]; ok {
+			merged.Merge(stored)
+		}
+		before := merged.Bytes()
+		merged.Merge(sketch)
+		if !bytes.Equal(before, merged.Bytes()) {
+			changed[role] = merged
+		}
+	}
+	return changed, nil
+}
+
+// keepAddressSketches remembers committed sketches of the zone
+func (p *PostgresProcessor) keepAddressSketches(chainID string, sketches map[string]*hll.Sketch) {
+	for role, sketch := range sketches {
+		p.hourSketches[chainID].sketches[role] = sketch
+	}
+}
+
+// querier is either connection or transaction
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// loadAddressSketches returns hourly sketches of the zone during [from, to) merged by role
+func loadAddressSketches(ctx context.Context, q querier, zone string, from, to time.Time) (map[string]*hll.Sketch, error) {
+	rows, err := q.Query(ctx, fmt.Sprintf(addressSketchesQuery, zone, from.Format(Format), to.Format(Format)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sketches := make(map[string]*hll.Sketch)
+	for rows.Next() {
+		var role string
+		var registers []byte
+		if err := rows.Scan(&role, &registers); err != nil {
+			return nil, err
+		}
+		sketch, err := hll.FromBytes(registers)
+		if err != nil {
+			return nil, err
+		}
+		if merged, ok := sketches[role]; ok {
+			merged.Merge(sketch)
+		} else {
+			sketches[role] = sketch
+		}
+	}
+	return sketches, rows.Err()
+}
+
+// UniqueAddresses returns approximate number of distinct addresses of the zone with given role
+// active during [from, to), it merges hourly sketches and does not read active addresses
+func (p *PostgresProcessor) UniqueAddresses(ctx context.Context, zone, role string, from, to time.Time) (uint64, error) {
+	sketches, err := loadAddressSketches(ctx, p.conn, zone, from, to)
+	if err != nil {
+		return 0, err
+	}
+	sketch, ok := sketches[role]
+	if !ok {
+		return 0, nil
+	}
+	return sketch.Count(), nil
+}
@@ -2,17 +2,74 @@ package postgres
 
 // queries that write to db
 
-const addZoneQuery = `insert into zones(name, chain_id, is_enabled, is_caught_up) values %s
+// metadata of the registry is set only when zone is inserted, later it is updated on registry reload
+const addZoneQuery = `insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values %s
     on conflict (chain_id) do update
         set is_enabled = %t;`
 
-const addImplicitZoneQuery = `insert into zones(name, chain_id, is_enabled, is_caught_up) values %s
+const addImplicitZoneQuery = `insert into zones(name, chain_id, is_enabled, is_caught_up, bech32_prefix, logo_url, native_denoms) values %s
     on conflict (chain_id) do nothing;`
 
-const markBlockQuery = `insert into blocks_log(zone, last_processed_block, last_updated_at) values %s
+// only zones which are already indexed or referred to by clients are updated
+const updateZonesMetadataQuery = `update zones
+    set name = m.name,
+        bech32_prefix = m.bech32_prefix,
+        logo_url = m.logo_url,
+        native_denoms = m.native_denoms::jsonb
+    from (values %s) as m(chain_id, name, bech32_prefix, logo_url, native_denoms)
+        where zones.chain_id = m.chain_id
+            and (zones.name, zones.bech32_prefix, zones.logo_url, zones.native_denoms)
+                is distinct from (m.name, m.bech32_prefix, m.logo_url, m.native_denoms::jsonb);`
+
+// zones removed from the registry get back the metadata they are inserted with when the registry does not know them
+const clearZonesMetadataQuery = `update zones
+    set name = chain_id,
+        bech32_prefix = null,
+        logo_url = null,
+        native_denoms = null
+        where chain_id <> all(array[%s]::text[])
+            and (name, bech32_prefix, logo_url, native_denoms) is distinct from (chain_id, null, null, null);`
+
+const markBlockQuery = `insert into blocks_log(zone, last_processed_block, last_updated_at, last_block_time) values %s
     on conflict (zone) do update
         set last_processed_block = blocks_log.last_processed_block + 1,
-            last_updated_at = '%s';`
+            last_updated_at = '%s',
+            last_block_time = '%s';`
+
+// blocks between the last processed one and the given height are skipped
+const resyncBlockQuery = `update blocks_log
+    set last_processed_block = %[2]d
+        where zone = '%[1]s' and last_processed_block < %[2]d;`
+
+// zone is not touched if its status is already the same, null status is updated too
+const markCaughtUpQuery = `update zones
+    set is_caught_up = %[2]t
+        where chain_id = '%[1]s' and is_caught_up is distinct from %[2]t;`
+
+// zones which sent no blocks since the cutoff are not caught up anymore
+const markStaleZonesQuery = `update zones
+    set is_caught_up = false
+        from blocks_log b
+        where b.zone = zones.chain_id and b.last_block_time < '%s' and zones.is_caught_up is distinct from false;`
+
+// block interval is taken from the previous block of the zone, blocks which are already stored are not counted again
+const addBlockStatsQuery = `with block as (
+    insert into block_stats(zone, height, time, txs_cnt, msgs_cnt, interval_ms)
+        select '%[1]s', %[2]d, timestamp '%[3]s', %[4]d, %[5]d,
+            (select (extract(epoch from timestamp '%[3]s' - b.time) * 1000)::bigint from block_stats b
+                where b.zone = '%[1]s' and b.height = %[2]d - 1)
+    on conflict (zone, height) do nothing
+    returning zone, time, txs_cnt, msgs_cnt, interval_ms)
+insert into block_hourly_stats(zone, hour, period, blocks_cnt, empty_blocks_cnt, txs_cnt, msgs_cnt, intervals_cnt, interval_sum_ms, interval_max_ms)
+    select zone, date_trunc('hour', time), 1, 1, (txs_cnt = 0)::int, txs_cnt, msgs_cnt, (interval_ms is not null)::int, coalesce(interval_ms, 0), interval_ms from block
+    on conflict (zone, hour, period) do update
+        set blocks_cnt = block_hourly_stats.blocks_cnt + EXCLUDED.blocks_cnt,
+            empty_blocks_cnt = block_hourly_stats.empty_blocks_cnt + EXCLUDED.empty_blocks_cnt,
+            txs_cnt = block_hourly_stats.txs_cnt + EXCLUDED.txs_cnt,
+            msgs_cnt = block_hourly_stats.msgs_cnt + EXCLUDED.msgs_cnt,
+            intervals_cnt = block_hourly_stats.intervals_cnt + EXCLUDED.intervals_cnt,
+            interval_sum_ms = block_hourly_stats.interval_sum_ms + EXCLUDED.interval_sum_ms,
+            interval_max_ms = greatest(block_hourly_stats.interval_max_ms, EXCLUDED.interval_max_ms);`
 
 const addTxStatsQuery = `insert into total_tx_hourly_stats(zone, hour, txs_cnt, txs_w_ibc_xfer_cnt, period, txs_w_ibc_xfer_fail_cnt, total_coin_turnover_amount) values %s
     on conflict (hour, zone, period) do update
@@ -21,11 +78,91 @@ const addTxStatsQuery = `insert into total_tx_hourly_stats(zone, hour, txs_cnt,
 			txs_w_ibc_xfer_fail_cnt = total_tx_hourly_stats.txs_w_ibc_xfer_fail_cnt + %d,
             total_coin_turnover_amount = total_tx_hourly_stats.total_coin_turnover_amount + %d;`
 
-const addActiveAddressesQuery = `insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer) values %s
+// display and usd amounts are rescaled from the total amount, so they are right even if the hour was started
+// without denom metadata or price, vouchers are displayed in units of their base denom and priced by it
+const addTxTurnoverQuery = `insert into total_coin_turnover_hourly_stats(zone, hour, period, denom, amount, amount_display, amount_usd)
+    select v.zone, v.hour, v.period, v.denom, v.amount, v.amount / power(10::numeric, m.exponent), v.amount / power(10::numeric, m.exponent) * p.price_usd
+    from (values %s) as v(zone, hour, period, denom, amount, base_denom)
+        left join denom_traces t on t.zone = v.zone and t.ibc_denom = v.denom
+        left join denom_metadata m on m.denom = coalesce(t.base_denom, v.base_denom)
+        left join token_prices p on p.denom = m.denom and p.hour = v.hour
+    on conflict (zone, hour, period, denom) do update
+        set amount = total_coin_turnover_hourly_stats.amount + EXCLUDED.amount,
+            amount_display = coalesce((total_coin_turnover_hourly_stats.amount + EXCLUDED.amount) * EXCLUDED.amount_display / nullif(EXCLUDED.amount, 0),
+                total_coin_turnover_hourly_stats.amount_display),
+            amount_usd = coalesce((total_coin_turnover_hourly_stats.amount + EXCLUDED.amount) * EXCLUDED.amount_usd / nullif(EXCLUDED.amount, 0),
+                total_coin_turnover_hourly_stats.amount_usd);`
+
+// duplicated addresses are merged before upsert, so one statement can insert all addresses of the block
+const addActiveAddressesQuery = `insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)
+    select address, '%s', '%s', %d, bool_or(is_internal_tx), bool_or(is_internal_transfer), bool_or(is_external_transfer), bool_or(is_internal_receive), bool_or(is_external_receive),
+            (array_agg(address_payload) filter (where address_payload is not null))[1]
+        from unnest(array[%s]::text[], array[%s]::boolean[], array[%s]::boolean[], array[%s]::boolean[], array[%s]::boolean[], array[%s]::boolean[], array[%s]::bytea[])
+            as t(address, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)
+        group by address
     on conflict (address, zone, hour, period) do update
         set is_internal_tx = active_addresses.is_internal_tx or EXCLUDED.is_internal_tx,
 			is_internal_transfer = active_addresses.is_internal_transfer or EXCLUDED.is_internal_transfer,
-			is_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer;`
+			is_external_transfer = active_addresses.is_external_transfer or EXCLUDED.is_external_transfer,
+			is_internal_receive = active_addresses.is_internal_receive or EXCLUDED.is_internal_receive,
+			is_external_receive = active_addresses.is_external_receive or EXCLUDED.is_external_receive,
+			address_payload = coalesce(active_addresses.address_payload, EXCLUDED.address_payload);`
+
+// addresses which are already in first seen index are not counted,
+// so the hour of tx stats must be inserted before
+const addNewAddressesQuery = `with new_addresses as (
+    insert into address_first_seen(zone, address, hour)
+        select '%[1]s', address, '%[2]s' from unnest(array[%[3]s]::text[]) as t(address)
+    on conflict (zone, address) do nothing
+    returning address)
+update total_tx_hourly_stats
+    set new_addresses_cnt = new_addresses_cnt + (select count(*) from new_addresses)
+        where zone = '%[1]s' and hour = '%[2]s' and period = 1;`
+
+// first hours of addresses which were active before address_first_seen was kept are taken from active addresses,
+// senders of received ibc transfers are addresses of the counterparty zone
+const backfillFirstSeenAddressesQuery = `insert into address_first_seen(zone, address, hour)
+    select zone, address, min(hour) from active_addresses
+        where period = 1 and (is_internal_tx or is_internal_transfer or is_internal_receive or is_external_receive)
+        group by zone, address
+    on conflict (zone, address) do update
+        set hour = EXCLUDED.hour
+        where EXCLUDED.hour < address_first_seen.hour;`
+
+// counterparty senders which were counted as new addresses of the receiving zone are removed
+const deleteCounterpartyFirstSeenQuery = `delete from address_first_seen f
+    where not exists (select 1 from active_addresses a
+        where a.zone = f.zone and a.address = f.address and a.period = 1
+            and (a.is_internal_tx or a.is_internal_transfer or a.is_internal_receive or a.is_external_receive));`
+
+// new addresses are recounted after backfill, changed hours are queued for rollup
+const recountNewAddressesQuery = `with recounted as (
+    update total_tx_hourly_stats s
+        set new_addresses_cnt = c.new_addresses_cnt
+        from (
+            select t.zone, t.hour, (select count(*) from address_first_seen f where f.zone = t.zone and f.hour = t.hour) as new_addresses_cnt
+            from total_tx_hourly_stats t
+                where t.period = 1) as c
+        where s.zone = c.zone and s.hour = c.hour and s.period = 1
+            and s.new_addresses_cnt is distinct from c.new_addresses_cnt
+        returning s.zone, s.hour
+)
+insert into rollup_queue(zone, hour) select zone, hour from recounted
+    on conflict (zone, hour) do nothing;`
+
+// sketches are merged by processor, stored sketch is replaced by the merged one
+const addAddressSketchesQuery = `insert into active_addresses_hll(zone, hour, period, role, sketch) values %s
+    on conflict (zone, hour, period, role) do update
+        set sketch = EXCLUDED.sketch;`
+
+const addInvalidAddressesQuery = `insert into invalid_addresses_hourly_stats(zone, hour, address, reason, cnt) values %s
+    on conflict (zone, hour, address, reason) do update
+        set cnt = invalid_addresses_hourly_stats.cnt + EXCLUDED.cnt;`
+
+const addMessageStatsQuery = `insert into message_types_hourly_stats(zone, hour, period, msg_type, msgs_cnt, msgs_fail_cnt) values %s
+    on conflict (zone, hour, period, msg_type) do update
+        set msgs_cnt = message_types_hourly_stats.msgs_cnt + EXCLUDED.msgs_cnt,
+            msgs_fail_cnt = message_types_hourly_stats.msgs_fail_cnt + EXCLUDED.msgs_fail_cnt;`
 
 const addClientsQuery = `insert into ibc_clients(zone, client_id, chain_id) values %s
     on conflict (zone, client_id) do nothing;`
@@ -43,18 +180,293 @@ const markChannelQuery = `update ibc_channels
 
 const addIbcStatsQuery = `insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt) values %s
     on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update
-        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + %d,
-            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + %d;`
+        set txs_cnt = ibc_transfer_hourly_stats.txs_cnt + EXCLUDED.txs_cnt,
+            txs_fail_cnt = ibc_transfer_hourly_stats.txs_fail_cnt + EXCLUDED.txs_fail_cnt;`
+
+const markChannelClosedAtQuery = `update ibc_channels
+    set closed_at = '%s'
+        where zone = '%s'
+        and channel_id = '%s'
+        and closed_at is null;`
+
+const addClosedChannelIbcStatsQuery = `insert into ibc_transfer_hourly_closed_channel_stats(zone, zone_src, zone_dest, hour, period, ibc_channel, txs_cnt, txs_fail_cnt) values %s
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update
+        set txs_cnt = ibc_transfer_hourly_closed_channel_stats.txs_cnt + %d,
+            txs_fail_cnt = ibc_transfer_hourly_closed_channel_stats.txs_fail_cnt + %d;`
+
+const addClosedChannelIbcCashflowQuery = `insert into ibc_transfer_hourly_closed_channel_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount) values %s
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update
+        set amount = ibc_transfer_hourly_closed_channel_cashflow.amount + EXCLUDED.amount;`
+
+// recalculation of closed channel stats works with whole hours, only hours starting at or after
+// channel close are recalculated, the closing hour is left as it was counted by the processor
+
+// used when transfers over closed channels are also counted in ibc transfer stats
+const rebuildClosedChannelIbcStatsQuery = `insert into ibc_transfer_hourly_closed_channel_stats(zone, zone_src, zone_dest, hour, period, ibc_channel, txs_cnt, txs_fail_cnt)
+    select s.zone, s.zone_src, s.zone_dest, s.hour, s.period, s.ibc_channel, s.txs_cnt, s.txs_fail_cnt from ibc_transfer_hourly_stats s
+        join ibc_channels c on c.zone = s.zone and c.channel_id = s.ibc_channel
+        where c.closed_at is not null and s.period = 1 and s.hour >= c.closed_at
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update
+        set txs_cnt = EXCLUDED.txs_cnt,
+            txs_fail_cnt = EXCLUDED.txs_fail_cnt;`
+
+const rebuildClosedChannelIbcCashflowQuery = `insert into ibc_transfer_hourly_closed_channel_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount)
+    select s.zone, s.zone_src, s.zone_dest, s.hour, s.period, s.ibc_channel, s.denom, s.amount from ibc_transfer_hourly_cashflow s
+        join ibc_channels c on c.zone = s.zone and c.channel_id = s.ibc_channel
+        where c.closed_at is not null and s.period = 1 and s.hour >= c.closed_at
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update
+        set amount = EXCLUDED.amount;`
+
+// used when transfers over closed channels are excluded from ibc transfer stats,
+// moved hours are queued for rollup
+const moveClosedChannelIbcStatsQuery = `with moved as (
+    delete from ibc_transfer_hourly_stats s using ibc_channels c
+        where c.zone = s.zone and c.channel_id = s.ibc_channel
+            and c.closed_at is not null and s.period = 1 and s.hour >= c.closed_at
+        returning s.*
+), queued as (
+    insert into rollup_queue(zone, hour) select distinct zone, hour from moved
+        on conflict (zone, hour) do nothing
+)
+insert into ibc_transfer_hourly_closed_channel_stats(zone, zone_src, zone_dest, hour, period, ibc_channel, txs_cnt, txs_fail_cnt)
+    select zone, zone_src, zone_dest, hour, period, ibc_channel, txs_cnt, txs_fail_cnt from moved
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update
+        set txs_cnt = ibc_transfer_hourly_closed_channel_stats.txs_cnt + EXCLUDED.txs_cnt,
+            txs_fail_cnt = ibc_transfer_hourly_closed_channel_stats.txs_fail_cnt + EXCLUDED.txs_fail_cnt;`
+
+const moveClosedChannelIbcCashflowQuery = `with moved as (
+    delete from ibc_transfer_hourly_cashflow s using ibc_channels c
+        where c.zone = s.zone and c.channel_id = s.ibc_channel
+            and c.closed_at is not null and s.period = 1 and s.hour >= c.closed_at
+        returning s.*
+), queued as (
+    insert into rollup_queue(zone, hour) select distinct zone, hour from moved
+        on conflict (zone, hour) do nothing
+)
+insert into ibc_transfer_hourly_closed_channel_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount)
+    select zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount from moved
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update
+        set amount = ibc_transfer_hourly_closed_channel_cashflow.amount + EXCLUDED.amount;`
+
+const addIbcCashflowQuery = `insert into ibc_transfer_hourly_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount, amount_display, amount_usd)
+    select v.zone, v.zone_src, v.zone_dest, v.hour, v.period, v.ibc_channel, v.denom, v.amount, v.amount / power(10::numeric, m.exponent), v.amount / power(10::numeric, m.exponent) * p.price_usd
+    from (values %s) as v(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount, base_denom)
+        left join denom_traces t on t.zone = v.zone and t.ibc_denom = v.denom
+        left join denom_metadata m on m.denom = coalesce(t.base_denom, v.base_denom)
+        left join token_prices p on p.denom = m.denom and p.hour = v.hour
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update
+        set amount = ibc_transfer_hourly_cashflow.amount + EXCLUDED.amount,
+            amount_display = coalesce((ibc_transfer_hourly_cashflow.amount + EXCLUDED.amount) * EXCLUDED.amount_display / nullif(EXCLUDED.amount, 0),
+                ibc_transfer_hourly_cashflow.amount_display),
+            amount_usd = coalesce((ibc_transfer_hourly_cashflow.amount + EXCLUDED.amount) * EXCLUDED.amount_usd / nullif(EXCLUDED.amount, 0),
+                ibc_transfer_hourly_cashflow.amount_usd);`
+
+const addPendingIbcTransfersQuery = `insert into pending_ibc_transfers(zone, ibc_channel, hour, is_source, is_failed, tx_hash, denoms, amounts) values %s;`
+
+// deletes parked transfers whose channels can be resolved and returns them with the counterparty chain,
+// %s is an optional zone filter
+const resolvePendingIbcTransfersQuery = `delete from pending_ibc_transfers p
+    using ibc_channels ch, ibc_connections con, ibc_clients cl
+    where ch.zone = p.zone and ch.channel_id = p.ibc_channel
+        and con.zone = ch.zone and con.connection_id = ch.connection_id
+        and cl.zone = con.zone and cl.client_id = con.client_id
+        and cl.chain_id is not null%s
+    returning p.zone, p.ibc_channel, p.hour, p.is_source, p.is_failed, p.tx_hash, p.denoms, p.amounts::text[], cl.chain_id, ch.closed_at is not null;`
+
+// outstanding amounts are running sums of the channel ledger, they are recalculated
+// from the hour on when transfers of past hours are added
+const recalculateChannelSupplyQuery = `update ibc_channel_hourly_supply s
+    set outstanding_amount = c.outstanding_amount
+    from (
+        select zone, ibc_channel, hour, denom,
+            sum(sent_amount - received_amount) over (partition by zone, ibc_channel, denom order by hour) as outstanding_amount
+        from ibc_channel_hourly_supply
+            where zone = '%[1]s' and ibc_channel = '%[2]s') as c
+    where s.zone = c.zone and s.ibc_channel = c.ibc_channel and s.hour = c.hour and s.denom = c.denom
+        and s.hour >= '%[3]s'
+        and s.outstanding_amount is distinct from c.outstanding_amount;`
+
+const addDenomMetadataQuery = `insert into denom_metadata(denom, display, exponent) values %s
+    on conflict (denom) do update
+        set display = EXCLUDED.display,
+            exponent = EXCLUDED.exponent;`
+
+const addDenomTracesQuery = `insert into denom_traces(zone, ibc_denom, path, base_denom, origin_zone) values %s
+    on conflict (zone, ibc_denom) do nothing;`
+
+// outstanding amount is a running total of sent minus received coins per channel,
+// positive value is escrowed on the zone, negative one is minted as vouchers,
+// sent vouchers are accounted under their base denom
+// vouchers and their base denom resolve to the same row, so they are summed before the upsert
+const addChannelSupplyQuery = `insert into ibc_channel_hourly_supply(zone, ibc_channel, hour, denom, sent_amount, received_amount, outstanding_amount)
+    select r.zone, r.ibc_channel, r.hour, r.denom, r.sent_amount, r.received_amount,
+        coalesce((select s.outstanding_amount from ibc_channel_hourly_supply s
+            where s.zone = r.zone and s.ibc_channel = r.ibc_channel and s.denom = r.denom and s.hour < r.hour
+            order by s.hour desc limit 1), 0) + r.sent_amount - r.received_amount
+    from (
+        select v.zone, v.ibc_channel, v.hour, coalesce(t.base_denom, v.denom) as denom, sum(v.sent_amount) as sent_amount, sum(v.received_amount) as received_amount
+        from (values %s) as v(zone, ibc_channel, hour, denom, sent_amount, received_amount)
+            left join denom_traces t on t.zone = v.zone and t.ibc_denom = v.denom and t.path = 'transfer/' || v.ibc_channel
+        group by v.zone, v.ibc_channel, v.hour, coalesce(t.base_denom, v.denom)) as r
+    on conflict (zone, ibc_channel, hour, denom) do update
+        set sent_amount = ibc_channel_hourly_supply.sent_amount + EXCLUDED.sent_amount,
+            received_amount = ibc_channel_hourly_supply.received_amount + EXCLUDED.received_amount,
+            outstanding_amount = ibc_channel_hourly_supply.outstanding_amount + EXCLUDED.sent_amount - EXCLUDED.received_amount;`
+
+// update time is changed only for new and changed prices, so their hours can be repriced
+const addTokenPricesQuery = `insert into token_prices(denom, hour, price_usd, updated_at)
+    select denom, hour, price_usd, now() from (values %s) as v(denom, hour, price_usd)
+    on conflict (denom, hour) do update
+        set price_usd = EXCLUDED.price_usd,
+            updated_at = EXCLUDED.updated_at
+        where token_prices.price_usd is distinct from EXCLUDED.price_usd;`
+
+// prices are changed by the price job and by other jobs which set updated_at
+const changedPricesQuery = `select min(hour), max(hour), max(updated_at) from token_prices
+    where updated_at > '%s';`
+
+const lastPriceUpdateQuery = `select coalesce(max(updated_at), timestamp 'epoch') from token_prices;`
+
+// reprice queries recalculate display and usd amounts of hourly stats during [%[1]s, %[2]s)
+const repriceTurnoverQuery = `with valued as (
+    select s.zone, s.hour, s.denom, s.amount / power(10::numeric, m.exponent) as amount_display, p.price_usd
+    from total_coin_turnover_hourly_stats s
+        left join denom_traces t on t.zone = s.zone and t.ibc_denom = s.denom
+        left join denom_metadata m on m.denom = coalesce(t.base_denom, regexp_replace(s.denom, '^(transfer/[^/]+/)+', ''))
+        left join token_prices p on p.denom = m.denom and p.hour = s.hour
+    where s.period = 1 and s.hour >= '%[1]s' and s.hour < '%[2]s')
+update total_coin_turnover_hourly_stats s
+    set amount_display = v.amount_display,
+        amount_usd = v.amount_display * v.price_usd
+    from valued v
+    where s.zone = v.zone and s.hour = v.hour and s.period = 1 and s.denom = v.denom;`
+
+const repriceIbcCashflowQuery = `with valued as (
+    select s.zone, s.zone_src, s.zone_dest, s.hour, s.ibc_channel, s.denom, s.amount / power(10::numeric, m.exponent) as amount_display, p.price_usd
+    from ibc_transfer_hourly_cashflow s
+        left join denom_traces t on t.zone = s.zone and t.ibc_denom = s.denom
+        left join denom_metadata m on m.denom = coalesce(t.base_denom, regexp_replace(s.denom, '^(transfer/[^/]+/)+', ''))
+        left join token_prices p on p.denom = m.denom and p.hour = s.hour
+    where s.period = 1 and s.hour >= '%[1]s' and s.hour < '%[2]s')
+update ibc_transfer_hourly_cashflow s
+    set amount_display = v.amount_display,
+        amount_usd = v.amount_display * v.price_usd
+    from valued v
+    where s.zone = v.zone and s.zone_src = v.zone_src and s.zone_dest = v.zone_dest and s.hour = v.hour
+        and s.period = 1 and s.ibc_channel = v.ibc_channel and s.denom = v.denom;`
+
+// repriced hours are queued, so longer periods are recalculated by rollup job
+const queueRepricedHoursQuery = `insert into rollup_queue(zone, hour)
+    select zone, hour from total_coin_turnover_hourly_stats
+        where period = 1 and hour >= '%[1]s' and hour < '%[2]s'
+    union
+    select zone, hour from ibc_transfer_hourly_cashflow
+        where period = 1 and hour >= '%[1]s' and hour < '%[2]s'
+    on conflict (zone, hour) do nothing;`
+
+const markRollupHourQuery = `insert into rollup_queue(zone, hour) values ('%s', '%s')
+    on conflict (zone, hour) do nothing;`
+
+const popRollupQueueQuery = `delete from rollup_queue
+    returning zone, hour;`
+
+// periods which have not ended yet wait in rollup_periods, so each period is rolled up once after its end
+const deferRollupPeriodQuery = `insert into rollup_periods(zone, hour, period) values ('%s', '%s', %d)
+    on conflict (zone, hour, period) do nothing;`
+
+const popRollupPeriodsQuery = `delete from rollup_periods
+    returning zone, hour, period;`
+
+// rollup queries recalculate stats of the period which starts at %[2]s from hourly stats,
+// rows of the period are deleted first, so groups without hourly rows anymore are removed too
+
+const deleteRollupStatsQuery = `delete from %[5]s
+    where zone = '%[1]s' and period = %[4]d and hour = '%[2]s';`
+
+const rollupTxStatsQuery = `insert into total_tx_hourly_stats(zone, hour, txs_cnt, txs_w_ibc_xfer_cnt, period, txs_w_ibc_xfer_fail_cnt, total_coin_turnover_amount, new_addresses_cnt)
+    select zone, '%[2]s', sum(txs_cnt), sum(txs_w_ibc_xfer_cnt), %[4]d, sum(txs_w_ibc_xfer_fail_cnt), sum(total_coin_turnover_amount), sum(new_addresses_cnt) from total_tx_hourly_stats
+        where zone = '%[1]s' and period = 1 and hour >= '%[2]s' and hour < '%[3]s'
+        group by zone
+    on conflict (hour, zone, period) do update
+        set txs_cnt = EXCLUDED.txs_cnt,
+            txs_w_ibc_xfer_cnt = EXCLUDED.txs_w_ibc_xfer_cnt,
+            txs_w_ibc_xfer_fail_cnt = EXCLUDED.txs_w_ibc_xfer_fail_cnt,
+            total_coin_turnover_amount = EXCLUDED.total_coin_turnover_amount,
+            new_addresses_cnt = EXCLUDED.new_addresses_cnt;`
+
+const rollupTxTurnoverQuery = `insert into total_coin_turnover_hourly_stats(zone, hour, period, denom, amount, amount_display, amount_usd)
+    select zone, '%[2]s', %[4]d, denom, sum(amount), sum(amount_display), sum(amount_usd) from total_coin_turnover_hourly_stats
+        where zone = '%[1]s' and period = 1 and hour >= '%[2]s' and hour < '%[3]s'
+        group by zone, denom
+    on conflict (zone, hour, period, denom) do update
+        set amount = EXCLUDED.amount,
+            amount_display = EXCLUDED.amount_display,
+            amount_usd = EXCLUDED.amount_usd;`
+
+const rollupActiveAddressesQuery = `insert into active_addresses(address, zone, hour, period, is_internal_tx, is_internal_transfer, is_external_transfer, is_internal_receive, is_external_receive, address_payload)
+    select address, zone, '%[2]s', %[4]d, bool_or(is_internal_tx), bool_or(is_internal_transfer), bool_or(is_external_transfer), bool_or(is_internal_receive), bool_or(is_external_receive),
+            (array_agg(address_payload) filter (where address_payload is not null))[1] from active_addresses
+        where zone = '%[1]s' and period = 1 and hour >= '%[2]s' and hour < '%[3]s'
+        group by address, zone
+    on conflict (address, zone, hour, period) do update
+        set is_internal_tx = EXCLUDED.is_internal_tx,
+            is_internal_transfer = EXCLUDED.is_internal_transfer,
+            is_external_transfer = EXCLUDED.is_external_transfer,
+            is_internal_receive = EXCLUDED.is_internal_receive,
+            is_external_receive = EXCLUDED.is_external_receive,
+            address_payload = EXCLUDED.address_payload;`
+
+const rollupMessageStatsQuery = `insert into message_types_hourly_stats(zone, hour, period, msg_type, msgs_cnt, msgs_fail_cnt)
+    select zone, '%[2]s', %[4]d, msg_type, sum(msgs_cnt), sum(msgs_fail_cnt) from message_types_hourly_stats
+        where zone = '%[1]s' and period = 1 and hour >= '%[2]s' and hour < '%[3]s'
+        group by zone, msg_type
+    on conflict (zone, hour, period, msg_type) do update
+        set msgs_cnt = EXCLUDED.msgs_cnt,
+            msgs_fail_cnt = EXCLUDED.msgs_fail_cnt;`
+
+const rollupBlockStatsQuery = `insert into block_hourly_stats(zone, hour, period, blocks_cnt, empty_blocks_cnt, txs_cnt, msgs_cnt, intervals_cnt, interval_sum_ms, interval_max_ms)
+    select zone, '%[2]s', %[4]d, sum(blocks_cnt), sum(empty_blocks_cnt), sum(txs_cnt), sum(msgs_cnt), sum(intervals_cnt), sum(interval_sum_ms), max(interval_max_ms) from block_hourly_stats
+        where zone = '%[1]s' and period = 1 and hour >= '%[2]s' and hour < '%[3]s'
+        group by zone
+    on conflict (zone, hour, period) do update
+        set blocks_cnt = EXCLUDED.blocks_cnt,
+            empty_blocks_cnt = EXCLUDED.empty_blocks_cnt,
+            txs_cnt = EXCLUDED.txs_cnt,
+            msgs_cnt = EXCLUDED.msgs_cnt,
+            intervals_cnt = EXCLUDED.intervals_cnt,
+            interval_sum_ms = EXCLUDED.interval_sum_ms,
+            interval_max_ms = EXCLUDED.interval_max_ms;`
+
+const rollupIbcStatsQuery = `insert into ibc_transfer_hourly_stats(zone, zone_src, zone_dest, hour, txs_cnt, period, ibc_channel, txs_fail_cnt)
+    select zone, zone_src, zone_dest, '%[2]s', sum(txs_cnt), %[4]d, ibc_channel, sum(txs_fail_cnt) from ibc_transfer_hourly_stats
+        where zone = '%[1]s' and period = 1 and hour >= '%[2]s' and hour < '%[3]s'
+        group by zone, zone_src, zone_dest, ibc_channel
+    on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel) do update
+        set txs_cnt = EXCLUDED.txs_cnt,
+            txs_fail_cnt = EXCLUDED.txs_fail_cnt;`
 
-const addIbcCashflowQuery = `insert into ibc_transfer_hourly_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount) values %s
+const rollupIbcCashflowQuery = `insert into ibc_transfer_hourly_cashflow(zone, zone_src, zone_dest, hour, period, ibc_channel, denom, amount, amount_display, amount_usd)
+    select zone, zone_src, zone_dest, '%[2]s', %[4]d, ibc_channel, denom, sum(amount), sum(amount_display), sum(amount_usd) from ibc_transfer_hourly_cashflow
+        where zone = '%[1]s' and period = 1 and hour >= '%[2]s' and hour < '%[3]s'
+        group by zone, zone_src, zone_dest, ibc_channel, denom
     on conflict(zone, zone_src, zone_dest, hour, period, ibc_channel, denom) do update
-        set amount = ibc_transfer_hourly_cashflow.amount + %d;`
+        set amount = EXCLUDED.amount,
+            amount_display = EXCLUDED.amount_display,
+            amount_usd = EXCLUDED.amount_usd;`
 
 // read-only queries
 
 const lastProcessedBlockQuery = `select last_processed_block from blocks_log
     where zone = '%s';`
 
+const openedChannelsQuery = `select ch.zone, ch.channel_id, ch.connection_id, cl.client_id, cl.chain_id from ibc_channels ch
+	join ibc_connections con on con.zone = ch.zone and con.connection_id = ch.connection_id
+	join ibc_clients cl on cl.zone = con.zone and cl.client_id = con.client_id
+	where ch.is_opened
+		and ch.closed_at is null
+		and cl.chain_id is not null
+	limit %d;`
+
 const chainIDFromClientIDQuery = `select chain_id from ibc_clients
 	where client_id = '%s'
 		and zone = '%s';`
@@ -67,6 +479,11 @@ const connectionIDFromChannelIDQuery = `select connection_id from ibc_channels
 	where channel_id = '%s'
 		and zone = '%s';`
 
-const statusFromChannelIDQuery = `select is_opened from ibc_channels
-	where channel_id = '%s'
-		and zone = '%s';`
+const channelInfoQuery = `select ch.connection_id, coalesce(con.client_id, ''), coalesce(cl.chain_id, ''), ch.is_opened, ch.closed_at is not null from ibc_channels ch
+	left join ibc_connections con on con.zone = ch.zone and con.connection_id = ch.connection_id
+	left join ibc_clients cl on cl.zone = con.zone and cl.client_id = con.client_id
+	where ch.channel_id = '%s'
+		and ch.zone = '%s';`
+
+const addressSketchesQuery = `select role, sketch from active_addresses_hll
+    where zone = '%s' and period = 1 and hour >= '%s' and hour < '%s';`
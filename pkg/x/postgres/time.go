@@ -2,3 +2,6 @@ package postgres
 
 // Format used by db to store timestamps
 const Format = "2006-01-02T15:04:05"
+
+// PreciseFormat keeps fractions of second, it is used for block times
+const PreciseFormat = "2006-01-02T15:04:05.999999"